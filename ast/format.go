@@ -0,0 +1,65 @@
+package ast
+
+import (
+	"strings"
+)
+
+// FormatWidth is a line width after which Format breaks boolean chains.
+const FormatWidth = 80
+
+// tabWidth is a width of indentation used to measure lines.
+const tabWidth = 4
+
+// Format prints node in canonical form: operators are separated by
+// single spaces, strings use double quotes, logical operators are spelled
+// as and, or and not, and chains of and/or longer than FormatWidth are
+// broken into lines, one operand per line:
+//
+//	user.age >= 18
+//		and user.country in ["US", "CA"]
+//		and not user.banned
+func Format(node Node) string {
+	return (&printer{format: true, width: FormatWidth}).print(node)
+}
+
+// chain prints chain of and/or operators, breaking it into lines if it is too long.
+func (p *printer) chain(operator string, left, right Node) string {
+	op := BinaryOperators[operator]
+	flat := &printer{format: true}
+	line := flat.left(op, left) + " " + operator + " " + flat.right(op, right)
+	if p.indent*tabWidth+len(line) <= p.width {
+		return line
+	}
+
+	// Collect operands of left-nested operators of the same precedence.
+	operands := []Node{right}
+	for {
+		n, ok := left.(*BinaryNode)
+		if !ok || p.operator(n.Operator) != operator {
+			break
+		}
+		operands = append(operands, n.Right)
+		left = n.Left
+	}
+
+	out := p.operand(leftParens(op, left), left, p.indent)
+	for i := len(operands) - 1; i >= 0; i-- {
+		out += "\n" + strings.Repeat("\t", p.indent+1) + operator + " " +
+			p.operand(rightParens(op, operands[i]), operands[i], p.indent+1)
+	}
+	return out
+}
+
+// operand prints operand of chain which starts a line indented by indent.
+// Operand broken into lines is enclosed in parentheses.
+func (p *printer) operand(parens bool, node Node, indent int) string {
+	saved := p.indent
+	p.indent = indent + 1
+	out := p.print(node)
+	p.indent = saved
+	if strings.Contains(out, "\n") {
+		tabs := strings.Repeat("\t", indent)
+		return "(\n" + tabs + "\t" + out + "\n" + tabs + ")"
+	}
+	return parenthesize(out, parens)
+}
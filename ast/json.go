@@ -0,0 +1,422 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/byte-power/jsexpr/file"
+)
+
+// jsonNode is JSON representation of any node, Kind is a name of node type
+// and only fields of this node type are set. Value holds a literal of
+// IdentifierNode, IntegerNode, FloatNode, BoolNode, StringNode and
+// ConstantNode, so value node of PairNode is held by Val. Set is a kind of
+// elements of set made by optimizer, which Value lists.
+type jsonNode struct {
+	Kind      string          `json:"kind"`
+	Location  *jsonLocation   `json:"location,omitempty"`
+	Range     *file.Range     `json:"range,omitempty"`
+	Type      string          `json:"type,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	Set       string          `json:"set,omitempty"`
+	Operator  string          `json:"operator,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Property  *string         `json:"property,omitempty"`
+	Regexp    *string         `json:"regexp,omitempty"`
+	Node      *jsonNode       `json:"node,omitempty"`
+	Left      *jsonNode       `json:"left,omitempty"`
+	Right     *jsonNode       `json:"right,omitempty"`
+	Index     *jsonNode       `json:"index,omitempty"`
+	From      *jsonNode       `json:"from,omitempty"`
+	To        *jsonNode       `json:"to,omitempty"`
+	Cond      *jsonNode       `json:"cond,omitempty"`
+	Exp1      *jsonNode       `json:"exp1,omitempty"`
+	Exp2      *jsonNode       `json:"exp2,omitempty"`
+	Key       *jsonNode       `json:"key,omitempty"`
+	Val       *jsonNode       `json:"val,omitempty"`
+	Arguments []*jsonNode     `json:"arguments,omitempty"`
+	Nodes     []*jsonNode     `json:"nodes,omitempty"`
+	Pairs     []*jsonNode     `json:"pairs,omitempty"`
+}
+
+type jsonLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// MarshalJSON encodes node and its children to JSON. Every node is an
+// object with "kind" field naming its type, like "BinaryNode", "location"
+// and "range" fields and fields of the node type in lower case.
+func MarshalJSON(node Node) ([]byte, error) {
+	return marshalJSON(node, false)
+}
+
+// MarshalJSONWithTypes is like MarshalJSON, but also encodes types set
+// by checker as "type" field. Types are informational, UnmarshalJSON
+// ignores them and nodes must be checked again.
+func MarshalJSONWithTypes(node Node) ([]byte, error) {
+	return marshalJSON(node, true)
+}
+
+func marshalJSON(node Node, types bool) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return json.Marshal(toJSON(node, types))
+}
+
+func toJSON(node Node, types bool) *jsonNode {
+	if node == nil {
+		return nil
+	}
+
+	j := &jsonNode{}
+	if loc := node.Location(); !loc.Empty() {
+		j.Location = &jsonLocation{Line: loc.Line, Column: loc.Column}
+	}
+	if r := node.Range(); !r.Empty() {
+		j.Range = &r
+	}
+	if t := node.Type(); types && t != nil {
+		j.Type = t.String()
+	}
+	list := func(nodes []Node) []*jsonNode {
+		out := make([]*jsonNode, len(nodes))
+		for i, n := range nodes {
+			out[i] = toJSON(n, types)
+		}
+		return out
+	}
+
+	switch n := node.(type) {
+	case *NilNode:
+		j.Kind = "NilNode"
+	case *IdentifierNode:
+		j.Kind = "IdentifierNode"
+		j.Value = literal(n.Value)
+	case *IntegerNode:
+		j.Kind = "IntegerNode"
+		j.Value = literal(n.Value)
+	case *FloatNode:
+		j.Kind = "FloatNode"
+		j.Value = literal(n.Value)
+	case *BoolNode:
+		j.Kind = "BoolNode"
+		j.Value = literal(n.Value)
+	case *StringNode:
+		j.Kind = "StringNode"
+		j.Value = literal(n.Value)
+	case *ConstantNode:
+		j.Kind = "ConstantNode"
+		j.Set, j.Value = constant(n.Value)
+	case *UnaryNode:
+		j.Kind = "UnaryNode"
+		j.Operator = n.Operator
+		j.Node = toJSON(n.Node, types)
+	case *BinaryNode:
+		j.Kind = "BinaryNode"
+		j.Operator = n.Operator
+		j.Left = toJSON(n.Left, types)
+		j.Right = toJSON(n.Right, types)
+	case *MatchesNode:
+		j.Kind = "MatchesNode"
+		if n.Regexp != nil {
+			r := n.Regexp.String()
+			j.Regexp = &r
+		}
+		j.Left = toJSON(n.Left, types)
+		j.Right = toJSON(n.Right, types)
+	case *PropertyNode:
+		j.Kind = "PropertyNode"
+		j.Node = toJSON(n.Node, types)
+		j.Property = &n.Property
+	case *IndexNode:
+		j.Kind = "IndexNode"
+		j.Node = toJSON(n.Node, types)
+		j.Index = toJSON(n.Index, types)
+	case *SliceNode:
+		j.Kind = "SliceNode"
+		j.Node = toJSON(n.Node, types)
+		j.From = toJSON(n.From, types)
+		j.To = toJSON(n.To, types)
+	case *MethodNode:
+		j.Kind = "MethodNode"
+		j.Node = toJSON(n.Node, types)
+		j.Method = n.Method
+		j.Arguments = list(n.Arguments)
+	case *FunctionNode:
+		j.Kind = "FunctionNode"
+		j.Name = n.Name
+		j.Arguments = list(n.Arguments)
+	case *BuiltinNode:
+		j.Kind = "BuiltinNode"
+		j.Name = n.Name
+		j.Arguments = list(n.Arguments)
+	case *ClosureNode:
+		j.Kind = "ClosureNode"
+		j.Node = toJSON(n.Node, types)
+	case *PointerNode:
+		j.Kind = "PointerNode"
+	case *ConditionalNode:
+		j.Kind = "ConditionalNode"
+		j.Cond = toJSON(n.Cond, types)
+		j.Exp1 = toJSON(n.Exp1, types)
+		j.Exp2 = toJSON(n.Exp2, types)
+	case *ArrayNode:
+		j.Kind = "ArrayNode"
+		j.Nodes = list(n.Nodes)
+	case *MapNode:
+		j.Kind = "MapNode"
+		j.Pairs = list(n.Pairs)
+	case *PairNode:
+		j.Kind = "PairNode"
+		j.Key = toJSON(n.Key, types)
+		j.Val = toJSON(n.Value, types)
+	case *ErrorNode:
+		j.Kind = "ErrorNode"
+		j.Node = toJSON(n.Node, types)
+	default:
+		panic(fmt.Sprintf("cannot marshal %T", node))
+	}
+	return j
+}
+
+func literal(v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// constant encodes value of ConstantNode. Sets made by optimizer from
+// arrays are encoded as sorted arrays with kind of their elements.
+func constant(v interface{}) (string, json.RawMessage) {
+	switch s := v.(type) {
+	case map[int]struct{}:
+		keys := make([]int, 0, len(s))
+		for k := range s {
+			keys = append(keys, k)
+		}
+		sort.Ints(keys)
+		return "int", literal(keys)
+	case map[string]struct{}:
+		keys := make([]string, 0, len(s))
+		for k := range s {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return "string", literal(keys)
+	}
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Map && t.Elem() == reflect.TypeOf(struct{}{}) {
+		panic(fmt.Sprintf("cannot marshal set of %v", t.Key()))
+	}
+	return "", literal(v)
+}
+
+// UnmarshalJSON decodes node encoded by MarshalJSON. Values of
+// ConstantNode are decoded as JSON values: integral numbers become int
+// and other ones float64, arrays and objects become []interface{} and
+// map[string]interface{}. Sets made by optimizer keep their type.
+func UnmarshalJSON(data []byte) (Node, error) {
+	var j jsonNode
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	return fromJSON(&j, "node")
+}
+
+func fromJSON(j *jsonNode, field string) (Node, error) {
+	if j == nil {
+		return nil, fmt.Errorf("missing %v", field)
+	}
+
+	var node Node
+	var err error
+	// Helpers record the first error.
+	child := func(c *jsonNode, field string) Node {
+		if err != nil {
+			return nil
+		}
+		var n Node
+		n, err = fromJSON(c, j.Kind+"."+field)
+		return n
+	}
+	optional := func(c *jsonNode, field string) Node {
+		if c == nil {
+			return nil
+		}
+		return child(c, field)
+	}
+	list := func(cs []*jsonNode, field string) []Node {
+		out := make([]Node, len(cs))
+		for i, c := range cs {
+			out[i] = child(c, fmt.Sprintf("%v[%v]", field, i))
+		}
+		return out
+	}
+	value := func(v interface{}) {
+		if err != nil {
+			return
+		}
+		if len(j.Value) == 0 {
+			err = fmt.Errorf("missing %v.value", j.Kind)
+			return
+		}
+		if e := json.Unmarshal(j.Value, v); e != nil {
+			err = fmt.Errorf("%v.value: %v", j.Kind, e)
+		}
+	}
+
+	switch j.Kind {
+	case "NilNode":
+		node = &NilNode{}
+	case "IdentifierNode":
+		n := &IdentifierNode{}
+		value(&n.Value)
+		node = n
+	case "IntegerNode":
+		n := &IntegerNode{}
+		value(&n.Value)
+		node = n
+	case "FloatNode":
+		n := &FloatNode{}
+		value(&n.Value)
+		node = n
+	case "BoolNode":
+		n := &BoolNode{}
+		value(&n.Value)
+		node = n
+	case "StringNode":
+		n := &StringNode{}
+		value(&n.Value)
+		node = n
+	case "ConstantNode":
+		n := &ConstantNode{}
+		switch j.Set {
+		case "":
+			if len(j.Value) > 0 {
+				d := json.NewDecoder(bytes.NewReader(j.Value))
+				d.UseNumber()
+				if e := d.Decode(&n.Value); e != nil {
+					err = fmt.Errorf("%v.value: %v", j.Kind, e)
+				}
+				n.Value = fromNumbers(n.Value)
+			}
+		case "int":
+			var keys []int
+			value(&keys)
+			set := make(map[int]struct{}, len(keys))
+			for _, k := range keys {
+				set[k] = struct{}{}
+			}
+			n.Value = set
+		case "string":
+			var keys []string
+			value(&keys)
+			set := make(map[string]struct{}, len(keys))
+			for _, k := range keys {
+				set[k] = struct{}{}
+			}
+			n.Value = set
+		default:
+			err = fmt.Errorf("unknown %v.set %q", j.Kind, j.Set)
+		}
+		node = n
+	case "UnaryNode":
+		node = &UnaryNode{Operator: j.Operator, Node: child(j.Node, "node")}
+	case "BinaryNode":
+		node = &BinaryNode{Operator: j.Operator, Left: child(j.Left, "left"), Right: child(j.Right, "right")}
+	case "MatchesNode":
+		// Regexp is compiled from string on the right like in parser,
+		// so it can't disagree with it.
+		n := &MatchesNode{Left: child(j.Left, "left"), Right: child(j.Right, "right")}
+		s, ok := n.Right.(*StringNode)
+		if j.Regexp != nil && err == nil && (!ok || s.Value != *j.Regexp) {
+			err = fmt.Errorf("%v.regexp %q does not match right", j.Kind, *j.Regexp)
+		}
+		if ok && err == nil {
+			n.Regexp, err = regexp.Compile(s.Value)
+		}
+		node = n
+	case "PropertyNode":
+		if j.Property == nil {
+			return nil, fmt.Errorf("missing %v.property", j.Kind)
+		}
+		node = &PropertyNode{Node: child(j.Node, "node"), Property: *j.Property}
+	case "IndexNode":
+		node = &IndexNode{Node: child(j.Node, "node"), Index: child(j.Index, "index")}
+	case "SliceNode":
+		node = &SliceNode{Node: child(j.Node, "node"), From: optional(j.From, "from"), To: optional(j.To, "to")}
+	case "MethodNode":
+		node = &MethodNode{Node: child(j.Node, "node"), Method: j.Method, Arguments: list(j.Arguments, "arguments")}
+	case "FunctionNode":
+		// Fast depends on type of function, so it is left to checker.
+		node = &FunctionNode{Name: j.Name, Arguments: list(j.Arguments, "arguments")}
+	case "BuiltinNode":
+		node = &BuiltinNode{Name: j.Name, Arguments: list(j.Arguments, "arguments")}
+	case "ClosureNode":
+		node = &ClosureNode{Node: child(j.Node, "node")}
+	case "PointerNode":
+		node = &PointerNode{}
+	case "ConditionalNode":
+		node = &ConditionalNode{Cond: child(j.Cond, "cond"), Exp1: child(j.Exp1, "exp1"), Exp2: child(j.Exp2, "exp2")}
+	case "ArrayNode":
+		node = &ArrayNode{Nodes: list(j.Nodes, "nodes")}
+	case "MapNode":
+		pairs := list(j.Pairs, "pairs")
+		for i, pair := range pairs {
+			if _, ok := pair.(*PairNode); !ok && err == nil {
+				err = fmt.Errorf("MapNode.pairs[%v] must be PairNode", i)
+			}
+		}
+		node = &MapNode{Pairs: pairs}
+	case "PairNode":
+		node = &PairNode{Key: child(j.Key, "key"), Value: child(j.Val, "val")}
+	case "ErrorNode":
+		node = &ErrorNode{Node: optional(j.Node, "node")}
+	case "":
+		return nil, fmt.Errorf("missing kind of %v", field)
+	default:
+		return nil, fmt.Errorf("unknown kind %q of %v", j.Kind, field)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if j.Location != nil {
+		node.SetLocation(file.Location{Line: j.Location.Line, Column: j.Location.Column})
+	}
+	if j.Range != nil {
+		node.SetRange(*j.Range)
+	}
+	return node, nil
+}
+
+// fromNumbers replaces json.Number values with int or float64.
+func fromNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = fromNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = fromNumbers(v[k])
+		}
+	}
+	return v
+}
@@ -0,0 +1,182 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/checker"
+	"github.com/byte-power/jsexpr/conf"
+	"github.com/byte-power/jsexpr/file"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	tests := []string{
+		`nil`,
+		`a + 1 * 2.5`,
+		`!true or "str" != foo.bar`,
+		`foo["bar"][0]`,
+		`items[1:] + items[:2] + items[1:2]`,
+		`foo.Method(1, x)`,
+		`-fn(1, 2) in 1..3`,
+		`all(items, {# > 0 && .Value < 10})`,
+		`a ? b : c`,
+		`[1, 2, 3]`,
+		`{foo: 1, "bar": [x]}`,
+		`name matches "^a+$"`,
+		`name matches pattern`,
+	}
+
+	for _, input := range tests {
+		tree, err := parser.Parse(input)
+		require.NoError(t, err, input)
+
+		data, err := ast.MarshalJSON(tree.Node)
+		require.NoError(t, err, input)
+
+		node, err := ast.UnmarshalJSON(data)
+		require.NoError(t, err, input)
+		require.Equal(t, ast.Dump(tree.Node), ast.Dump(node), input)
+		require.Equal(t, tree.Node.Location(), node.Location(), input)
+		require.Equal(t, tree.Node.Range(), node.Range(), input)
+
+		again, err := ast.MarshalJSON(node)
+		require.NoError(t, err, input)
+		require.JSONEq(t, string(data), string(again), input)
+	}
+}
+
+func TestMarshalJSON_format(t *testing.T) {
+	tree, err := parser.Parse(`a + 1`)
+	require.NoError(t, err)
+
+	data, err := ast.MarshalJSON(tree.Node)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"kind": "BinaryNode",
+		"location": {"line": 1, "column": 2},
+		"range": {"start": {"line": 1, "column": 0, "offset": 0}, "end": {"line": 1, "column": 5, "offset": 5}},
+		"operator": "+",
+		"left": {
+			"kind": "IdentifierNode",
+			"location": {"line": 1, "column": 0},
+			"range": {"start": {"line": 1, "column": 0, "offset": 0}, "end": {"line": 1, "column": 1, "offset": 1}},
+			"value": "a"
+		},
+		"right": {
+			"kind": "IntegerNode",
+			"location": {"line": 1, "column": 4},
+			"range": {"start": {"line": 1, "column": 4, "offset": 4}, "end": {"line": 1, "column": 5, "offset": 5}},
+			"value": 1
+		}
+	}`, string(data))
+}
+
+func TestMarshalJSONWithTypes(t *testing.T) {
+	tree, err := parser.Parse(`a + 1`)
+	require.NoError(t, err)
+	_, err = checker.Check(tree, conf.New(map[string]interface{}{"a": 0}))
+	require.NoError(t, err)
+
+	data, err := ast.MarshalJSONWithTypes(tree.Node)
+	require.NoError(t, err)
+
+	var out struct {
+		Type string
+		Left struct{ Type string }
+	}
+	require.NoError(t, json.Unmarshal(data, &out))
+	require.Equal(t, "int", out.Type)
+	require.Equal(t, "int", out.Left.Type)
+
+	data, err = ast.MarshalJSON(tree.Node)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), `"type"`)
+}
+
+func TestUnmarshalJSON_constant(t *testing.T) {
+	var node ast.Node = &ast.ConstantNode{Value: []interface{}{1, 2.5, "a", map[string]interface{}{"b": 3}}}
+	node.SetLocation(file.Location{Line: 1, Column: 3})
+
+	data, err := ast.MarshalJSON(node)
+	require.NoError(t, err)
+
+	decoded, err := ast.UnmarshalJSON(data)
+	require.NoError(t, err)
+	require.Equal(t, node, decoded)
+}
+
+func TestUnmarshalJSON_set(t *testing.T) {
+	tests := []interface{}{
+		map[int]struct{}{3: {}, 1: {}},
+		map[string]struct{}{"b": {}, "a": {}},
+		map[string]struct{}{},
+	}
+
+	for _, set := range tests {
+		data, err := ast.MarshalJSON(&ast.ConstantNode{Value: set})
+		require.NoError(t, err)
+
+		decoded, err := ast.UnmarshalJSON(data)
+		require.NoError(t, err)
+		require.Equal(t, set, decoded.(*ast.ConstantNode).Value)
+	}
+
+	data, err := ast.MarshalJSON(&ast.ConstantNode{Value: map[int]struct{}{3: {}, 1: {}}})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"kind": "ConstantNode", "set": "int", "value": [1, 3]}`, string(data))
+
+	_, err = ast.MarshalJSON(&ast.ConstantNode{Value: map[float64]struct{}{1.5: {}}})
+	require.EqualError(t, err, "cannot marshal set of float64")
+}
+
+func TestUnmarshalJSON_flags(t *testing.T) {
+	node, err := ast.UnmarshalJSON([]byte(`{"kind": "MatchesNode", "left": {"kind": "NilNode"}, "right": {"kind": "StringNode", "value": "^a"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "^a", node.(*ast.MatchesNode).Regexp.String())
+
+	node, err = ast.UnmarshalJSON([]byte(`{"kind": "FunctionNode", "name": "foo", "fast": true}`))
+	require.NoError(t, err)
+	require.False(t, node.(*ast.FunctionNode).Fast)
+}
+
+func TestMarshalJSON_tolerant(t *testing.T) {
+	tree, _ := parser.ParseTolerant(`a + user.`)
+
+	data, err := ast.MarshalJSON(tree.Node)
+	require.NoError(t, err)
+
+	node, err := ast.UnmarshalJSON(data)
+	require.NoError(t, err)
+	require.Equal(t, ast.Dump(tree.Node), ast.Dump(node))
+}
+
+func TestUnmarshalJSON_errors(t *testing.T) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{`[]`, "cannot unmarshal array"},
+		{`{}`, "missing kind of node"},
+		{`{"kind": "FooNode"}`, `unknown kind "FooNode" of node`},
+		{`{"kind": "BinaryNode", "operator": "+", "left": {"kind": "NilNode"}}`, "missing BinaryNode.right"},
+		{`{"kind": "ArrayNode", "nodes": [{"kind": "NilNode"}, {}]}`, "missing kind of ArrayNode.nodes[1]"},
+		{`{"kind": "IntegerNode", "value": "1"}`, "IntegerNode.value: json: cannot unmarshal string"},
+		{`{"kind": "StringNode"}`, "missing StringNode.value"},
+		{`{"kind": "PropertyNode", "node": {"kind": "NilNode"}}`, "missing PropertyNode.property"},
+		{`{"kind": "MapNode", "pairs": [{"kind": "NilNode"}]}`, "MapNode.pairs[0] must be PairNode"},
+		{`{"kind": "PairNode", "key": {"kind": "NilNode"}}`, "missing PairNode.val"},
+		{`{"kind": "ConstantNode", "set": "bool", "value": [true]}`, `unknown ConstantNode.set "bool"`},
+		{`{"kind": "MatchesNode", "left": {"kind": "NilNode"}, "right": {"kind": "StringNode", "value": "("}}`, "missing closing )"},
+		{`{"kind": "MatchesNode", "regexp": "a", "left": {"kind": "NilNode"}, "right": {"kind": "NilNode"}}`, `MatchesNode.regexp "a" does not match right`},
+		{`{"kind": "MatchesNode", "regexp": "a", "left": {"kind": "NilNode"}, "right": {"kind": "StringNode", "value": "b"}}`, `MatchesNode.regexp "a" does not match right`},
+	}
+
+	for _, test := range tests {
+		_, err := ast.UnmarshalJSON([]byte(test.data))
+		require.Error(t, err, test.data)
+		require.Contains(t, err.Error(), test.err, test.data)
+	}
+}
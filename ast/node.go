@@ -11,6 +11,8 @@ import (
 type Node interface {
 	Location() file.Location
 	SetLocation(file.Location)
+	Range() file.Range
+	SetRange(file.Range)
 	Type() reflect.Type
 	SetType(reflect.Type)
 }
@@ -18,14 +20,18 @@ type Node interface {
 func Patch(node *Node, newNode Node) {
 	newNode.SetType((*node).Type())
 	newNode.SetLocation((*node).Location())
+	newNode.SetRange((*node).Range())
 	*node = newNode
 }
 
 type base struct {
 	loc      file.Location
+	rng      file.Range
 	nodeType reflect.Type
 }
 
+// Location returns location of the main token of node, like operator
+// of BinaryNode or name of PropertyNode.
 func (n *base) Location() file.Location {
 	return n.loc
 }
@@ -34,6 +40,16 @@ func (n *base) SetLocation(loc file.Location) {
 	n.loc = loc
 }
 
+// Range returns part of source node is parsed from. Range of
+// parenthesized expression does not include parentheses.
+func (n *base) Range() file.Range {
+	return n.rng
+}
+
+func (n *base) SetRange(r file.Range) {
+	n.rng = r
+}
+
 func (n *base) Type() reflect.Type {
 	return n.nodeType
 }
@@ -166,3 +182,10 @@ type PairNode struct {
 	Key   Node
 	Value Node
 }
+
+// ErrorNode takes place of invalid syntax in trees of parser.ParseTolerant.
+// Node is the operand parsed before the error, like user of "user.", or nil.
+type ErrorNode struct {
+	base
+	Node Node
+}
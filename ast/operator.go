@@ -0,0 +1,49 @@
+package ast
+
+// Associativity of binary operator.
+type Associativity int
+
+const (
+	LeftAssociative Associativity = iota + 1
+	RightAssociative
+)
+
+// OperatorPrecedence describes how tightly operator binds its operands,
+// operators with higher precedence bind tighter.
+type OperatorPrecedence struct {
+	Precedence    int
+	Associativity Associativity
+}
+
+var UnaryOperators = map[string]OperatorPrecedence{
+	"not": {50, LeftAssociative},
+	"!":   {50, LeftAssociative},
+	"-":   {500, LeftAssociative},
+	"+":   {500, LeftAssociative},
+}
+
+var BinaryOperators = map[string]OperatorPrecedence{
+	"or":         {10, LeftAssociative},
+	"||":         {10, LeftAssociative},
+	"and":        {15, LeftAssociative},
+	"&&":         {15, LeftAssociative},
+	"==":         {20, LeftAssociative},
+	"!=":         {20, LeftAssociative},
+	"<":          {20, LeftAssociative},
+	">":          {20, LeftAssociative},
+	">=":         {20, LeftAssociative},
+	"<=":         {20, LeftAssociative},
+	"not in":     {20, LeftAssociative},
+	"in":         {20, LeftAssociative},
+	"matches":    {20, LeftAssociative},
+	"contains":   {20, LeftAssociative},
+	"startsWith": {20, LeftAssociative},
+	"endsWith":   {20, LeftAssociative},
+	"..":         {25, LeftAssociative},
+	"+":          {30, LeftAssociative},
+	"-":          {30, LeftAssociative},
+	"*":          {60, LeftAssociative},
+	"/":          {60, LeftAssociative},
+	"%":          {60, LeftAssociative},
+	"**":         {70, RightAssociative},
+}
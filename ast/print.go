@@ -2,8 +2,13 @@ package ast
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
 func Dump(node Node) string {
@@ -57,3 +62,337 @@ var isCapital = regexp.MustCompile("^[A-Z]")
 func isPrivate(s string) bool {
 	return !isCapital.Match([]byte(s))
 }
+
+// Print returns source of expression tree. Parentheses are added only
+// where precedence of operators requires them, so parsing the source
+// gives the same tree. Nodes without own syntax are printed with an
+// equivalent one: "not in" operator as `not (a in b)`, property which is
+// not a valid identifier as `a["b-c"]`. ErrorNode of parser.ParseTolerant
+// is printed as its partial operand, or as <error> if there is none.
+func Print(node Node) string {
+	return (&printer{}).print(node)
+}
+
+type printer struct {
+	// format normalizes spelling of logical operators
+	// and breaks long boolean chains into lines.
+	format bool
+	width  int
+	indent int
+}
+
+// unaryPrecedence is a precedence of nodes printed with unary minus.
+const unaryPrecedence = 500
+
+// primaryPrecedence is a precedence of nodes which are not operators.
+const primaryPrecedence = 1000
+
+func (p *printer) print(node Node) string {
+	switch n := node.(type) {
+	case nil:
+		return "nil"
+	case *NilNode:
+		return "nil"
+	case *IdentifierNode:
+		return n.Value
+	case *IntegerNode:
+		return strconv.Itoa(n.Value)
+	case *FloatNode:
+		return formatFloat(n.Value)
+	case *BoolNode:
+		return strconv.FormatBool(n.Value)
+	case *StringNode:
+		return strconv.Quote(n.Value)
+	case *ConstantNode:
+		return p.constant(reflect.ValueOf(n.Value))
+	case *UnaryNode:
+		return p.unary(p.operator(n.Operator), n.Node)
+	case *BinaryNode:
+		if n.Operator == "not in" {
+			return p.unary(p.operator("not"), &BinaryNode{Operator: "in", Left: n.Left, Right: n.Right})
+		}
+		return p.binary(p.operator(n.Operator), n.Left, n.Right)
+	case *MatchesNode:
+		return p.binary("matches", n.Left, n.Right)
+	case *PropertyNode:
+		if !isIdentifier(n.Property) {
+			return p.base(n.Node) + "[" + strconv.Quote(n.Property) + "]"
+		}
+		if _, ok := n.Node.(*PointerNode); ok {
+			return "." + n.Property
+		}
+		return p.base(n.Node) + "." + n.Property
+	case *IndexNode:
+		return p.base(n.Node) + "[" + p.print(n.Index) + "]"
+	case *SliceNode:
+		out := p.base(n.Node) + "["
+		if n.From != nil {
+			out += p.print(n.From)
+		}
+		out += ":"
+		if n.To != nil {
+			out += p.print(n.To)
+		}
+		return out + "]"
+	case *MethodNode:
+		if _, ok := n.Node.(*PointerNode); ok {
+			return "." + n.Method + p.arguments(n.Arguments)
+		}
+		return p.base(n.Node) + "." + n.Method + p.arguments(n.Arguments)
+	case *FunctionNode:
+		return n.Name + p.arguments(n.Arguments)
+	case *BuiltinNode:
+		return n.Name + p.arguments(n.Arguments)
+	case *ClosureNode:
+		return "{" + p.print(n.Node) + "}"
+	case *PointerNode:
+		return "#"
+	case *ConditionalNode:
+		cond := p.print(n.Cond)
+		if precedence(n.Cond) == 0 {
+			cond = "(" + cond + ")"
+		}
+		if n.Exp1 == n.Cond {
+			return cond + " ?: " + p.print(n.Exp2)
+		}
+		return cond + " ? " + p.print(n.Exp1) + " : " + p.print(n.Exp2)
+	case *ArrayNode:
+		return "[" + p.list(n.Nodes) + "]"
+	case *MapNode:
+		return "{" + p.list(n.Pairs) + "}"
+	case *PairNode:
+		key := "(" + p.print(n.Key) + ")"
+		if s, ok := n.Key.(*StringNode); ok {
+			key = strconv.Quote(s.Value)
+			if isIdentifier(s.Value) {
+				key = s.Value
+			}
+		}
+		return key + ": " + p.print(n.Value)
+	case *ErrorNode:
+		if n.Node == nil {
+			return "<error>"
+		}
+		return p.print(n.Node)
+	default:
+		panic(fmt.Sprintf("cannot print %T", node))
+	}
+}
+
+func (p *printer) unary(operator string, node Node) string {
+	op := UnaryOperators[operator]
+	operand := p.print(node)
+	if precedence(node) < op.Precedence {
+		operand = "(" + operand + ")"
+	}
+	if operator == "not" || strings.HasPrefix(operand, "-") || strings.HasPrefix(operand, "+") {
+		return operator + " " + operand
+	}
+	return operator + operand
+}
+
+func (p *printer) binary(operator string, left, right Node) string {
+	op := BinaryOperators[operator]
+	if p.format && p.width > 0 && (operator == "and" || operator == "or") {
+		return p.chain(operator, left, right)
+	}
+	if operator == ".." {
+		return p.left(op, left) + operator + p.right(op, right)
+	}
+	return p.left(op, left) + " " + operator + " " + p.right(op, right)
+}
+
+// left prints left operand of binary operator op.
+func (p *printer) left(op OperatorPrecedence, node Node) string {
+	return parenthesize(p.print(node), leftParens(op, node))
+}
+
+// right prints right operand of binary operator op.
+func (p *printer) right(op OperatorPrecedence, node Node) string {
+	return parenthesize(p.print(node), rightParens(op, node))
+}
+
+func leftParens(op OperatorPrecedence, node Node) bool {
+	prec := precedence(node)
+	if _, ok := node.(*UnaryNode); ok {
+		// Operand of unary operator would include this binary operator.
+		return prec <= op.Precedence
+	}
+	return prec < op.Precedence || prec == op.Precedence && op.Associativity == RightAssociative
+}
+
+func rightParens(op OperatorPrecedence, node Node) bool {
+	prec := precedence(node)
+	return prec < op.Precedence || prec == op.Precedence && op.Associativity == LeftAssociative
+}
+
+func parenthesize(s string, parens bool) string {
+	if parens {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// base prints node which postfix operator is applied to.
+func (p *printer) base(node Node) string {
+	if e, ok := node.(*ErrorNode); ok && e.Node != nil {
+		return p.base(e.Node)
+	}
+	out := p.print(node)
+	switch n := node.(type) {
+	case *IdentifierNode, *PropertyNode, *IndexNode, *SliceNode, *MethodNode,
+		*FunctionNode, *BuiltinNode, *ArrayNode, *MapNode, *PointerNode, *ErrorNode:
+		return out
+	case *ConstantNode:
+		switch reflect.ValueOf(n.Value).Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return out
+		}
+	}
+	return "(" + out + ")"
+}
+
+func (p *printer) arguments(nodes []Node) string {
+	return "(" + p.list(nodes) + ")"
+}
+
+func (p *printer) list(nodes []Node) string {
+	out := make([]string, len(nodes))
+	for i, n := range nodes {
+		out[i] = p.print(n)
+	}
+	return strings.Join(out, ", ")
+}
+
+// operator returns spelling of operator, formatter uses
+// words for logical operators.
+func (p *printer) operator(operator string) string {
+	if p.format {
+		switch operator {
+		case "&&":
+			return "and"
+		case "||":
+			return "or"
+		case "!":
+			return "not"
+		}
+	}
+	return operator
+}
+
+func (p *printer) constant(v reflect.Value) string {
+	if !v.IsValid() {
+		return "nil"
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return formatFloat(v.Float())
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return "nil"
+		}
+		return p.constant(v.Elem())
+	case reflect.Slice, reflect.Array:
+		out := make([]string, v.Len())
+		for i := range out {
+			out[i] = p.constant(v.Index(i))
+		}
+		return "[" + strings.Join(out, ", ") + "]"
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]string, v.Len())
+		set := v.Type().Elem().Kind() == reflect.Struct && v.Type().Elem().NumField() == 0
+		for _, k := range v.MapKeys() {
+			key := p.constant(k)
+			if !set {
+				if k.Kind() == reflect.String && isIdentifier(k.String()) {
+					key = k.String()
+				}
+				values[key] = p.constant(v.MapIndex(k))
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if set {
+			// Sets are made by optimizer from arrays.
+			return "[" + strings.Join(keys, ", ") + "]"
+		}
+		for i, k := range keys {
+			keys[i] = k + ": " + values[k]
+		}
+		return "{" + strings.Join(keys, ", ") + "}"
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// precedence returns precedence of node as an operand.
+func precedence(node Node) int {
+	switch n := node.(type) {
+	case *ConditionalNode:
+		return 0
+	case *BinaryNode:
+		if n.Operator == "not in" {
+			return UnaryOperators["not"].Precedence
+		}
+		return BinaryOperators[n.Operator].Precedence
+	case *MatchesNode:
+		return BinaryOperators["matches"].Precedence
+	case *UnaryNode:
+		return UnaryOperators[n.Operator].Precedence
+	case *ErrorNode:
+		if n.Node != nil {
+			return precedence(n.Node)
+		}
+	case *IntegerNode:
+		if n.Value < 0 {
+			return unaryPrecedence
+		}
+	case *FloatNode:
+		if n.Value < 0 || math.Signbit(n.Value) {
+			return unaryPrecedence
+		}
+	case *ConstantNode:
+		v := reflect.ValueOf(n.Value)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.Int() < 0 {
+				return unaryPrecedence
+			}
+		case reflect.Float32, reflect.Float64:
+			if math.Signbit(v.Float()) {
+				return unaryPrecedence
+			}
+		}
+	}
+	return primaryPrecedence
+}
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// isIdentifier reports whether name can be written without quotes.
+func isIdentifier(name string) bool {
+	switch name {
+	case "", "in", "or", "not", "and", "matches", "contains", "startsWith", "endsWith":
+		return false
+	}
+	for i, r := range name {
+		if !(unicode.IsLetter(r) || r == '_' || r == '$' || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrint(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`nil`, `nil`},
+		{`a`, `a`},
+		{`0x1F`, `31`},
+		{`1.0`, `1.0`},
+		{`1e3`, `1000.0`},
+		{`'str\n'`, `"str\n"`},
+		{`(a + b) * c`, `(a + b) * c`},
+		{`a + (b * c)`, `a + b * c`},
+		{`(a - b) - c`, `a - b - c`},
+		{`a - (b - c)`, `a - (b - c)`},
+		{`a ** (b ** c)`, `a ** b ** c`},
+		{`(a ** b) ** c`, `(a ** b) ** c`},
+		{`-(a + b)`, `-(a + b)`},
+		{`-a ** 2`, `-a ** 2`},
+		{`- -a`, `- -a`},
+		{`not (a and b)`, `not (a and b)`},
+		{`not a * b`, `not a * b`},
+		{`(not a) * b`, `(not a) * b`},
+		{`!a && b || c`, `!a && b || c`},
+		{`a or (b and c)`, `a or b and c`},
+		{`(a or b) and c`, `(a or b) and c`},
+		{`a  ==  "b"`, `a == "b"`},
+		{`a in 1 .. (2 + 3)`, `a in 1..2 + 3`},
+		{`(1..2) + 3`, `(1..2) + 3`},
+		{`1.5..2`, `1.5..2`},
+		{`name matches "^a"`, `name matches "^a"`},
+		{`(a ? b : c) ? d : e`, `(a ? b : c) ? d : e`},
+		{`a ? b : c ? d : e`, `a ? b : c ? d : e`},
+		{`(a ? b : c) + 1`, `(a ? b : c) + 1`},
+		{`a ?: b`, `a ?: b`},
+		{`foo.bar.baz`, `foo.bar.baz`},
+		{`foo["bar"][0]`, `foo["bar"][0]`},
+		{`(a + b).c`, `(a + b).c`},
+		{`("a").b`, `("a").b`},
+		{`(-a)[0]`, `(-a)[0]`},
+		{`items[1:] + items[:2] + items[1:2] + items[:]`, `items[1:] + items[:2] + items[1:2] + items[:]`},
+		{`foo.Method(1, a ? b : c)`, `foo.Method(1, a ? b : c)`},
+		{`fn()`, `fn()`},
+		{`len(items)`, `len(items)`},
+		{`all(items, {# > 0 and .Value < 10 and #[0] == .Method()})`, `all(items, {# > 0 and .Value < 10 and #[0] == .Method()})`},
+		{`[1, 2, [3]]`, `[1, 2, [3]]`},
+		{`{foo: 1, 'bar baz': 2, 3: x, (a + b): c, "in": 4}`, `{foo: 1, "bar baz": 2, "3": x, (a + b): c, "in": 4}`},
+	}
+
+	for _, test := range tests {
+		tree, err := parser.Parse(test.input)
+		require.NoError(t, err, test.input)
+
+		source := ast.Print(tree.Node)
+		require.Equal(t, test.expected, source, test.input)
+
+		again, err := parser.Parse(source)
+		require.NoError(t, err, source)
+		require.Equal(t, ast.Dump(tree.Node), ast.Dump(again.Node), source)
+	}
+}
+
+func TestPrint_nodes(t *testing.T) {
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{
+			&ast.BinaryNode{Operator: "not in", Left: &ast.IdentifierNode{Value: "a"}, Right: &ast.IdentifierNode{Value: "b"}},
+			`not (a in b)`,
+		},
+		{
+			&ast.PropertyNode{Node: &ast.IdentifierNode{Value: "a"}, Property: "b-c"},
+			`a["b-c"]`,
+		},
+		{
+			&ast.BinaryNode{Operator: "-", Left: &ast.IntegerNode{Value: 1}, Right: &ast.IntegerNode{Value: -2}},
+			`1 - -2`,
+		},
+		{
+			&ast.BinaryNode{Operator: "**", Left: &ast.FloatNode{Value: -2}, Right: &ast.IntegerNode{Value: 2}},
+			`-2.0 ** 2`,
+		},
+		{
+			&ast.PropertyNode{Node: &ast.IntegerNode{Value: 1}, Property: "a"},
+			`(1).a`,
+		},
+		{
+			&ast.ConstantNode{Value: []interface{}{1, 2.5, "a", nil, map[string]interface{}{"b": true, "c d": uint8(3)}}},
+			`[1, 2.5, "a", nil, {"c d": 3, b: true}]`,
+		},
+		{
+			&ast.BinaryNode{Operator: "in", Left: &ast.IdentifierNode{Value: "a"}, Right: &ast.ConstantNode{Value: map[string]struct{}{"y": {}, "x": {}}}},
+			`a in ["x", "y"]`,
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, ast.Print(test.node))
+	}
+}
+
+func TestPrint_error(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`a + user.`, `a + user`},
+		{`(a or b).`, `a or b`},
+		{`foo(1, )`, `foo(1, <error>)`},
+		{`a and (b or`, `a and (b or <error>)`},
+	}
+
+	for _, test := range tests {
+		tree, _ := parser.ParseTolerant(test.input)
+		require.Equal(t, test.expected, ast.Print(tree.Node), test.input)
+		require.Equal(t, test.expected, ast.Format(tree.Node), test.input)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`a&&b||!c`, `a and b or not c`},
+		{`'a'+"b"`, `"a" + "b"`},
+		{
+			`user.age >= 18 && user.country in ['US', 'CA'] && !user.banned && user.name startsWith 'A'`,
+			"user.age >= 18\n" +
+				"\tand user.country in [\"US\", \"CA\"]\n" +
+				"\tand not user.banned\n" +
+				"\tand user.name startsWith \"A\"",
+		},
+		{
+			`user.age >= 18 && (user.country == 'United States' || user.country == 'Canada' || user.country == 'Mexico')`,
+			"user.age >= 18\n" +
+				"\tand (\n" +
+				"\t\tuser.country == \"United States\"\n" +
+				"\t\t\tor user.country == \"Canada\"\n" +
+				"\t\t\tor user.country == \"Mexico\"\n" +
+				"\t)",
+		},
+	}
+
+	for _, test := range tests {
+		tree, err := parser.Parse(test.input)
+		require.NoError(t, err, test.input)
+
+		source := ast.Format(tree.Node)
+		require.Equal(t, test.expected, source, test.input)
+
+		again, err := parser.Parse(source)
+		require.NoError(t, err, source)
+		require.Equal(t, source, ast.Format(again.Node), source)
+	}
+}
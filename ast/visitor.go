@@ -55,6 +55,7 @@ func (w *walker) walk(node *Node) {
 		w.walk(&n.Index)
 		w.visitor.Exit(node)
 	case *SliceNode:
+		w.walk(&n.Node)
 		if n.From != nil {
 			w.walk(&n.From)
 		}
@@ -102,6 +103,11 @@ func (w *walker) walk(node *Node) {
 		w.walk(&n.Key)
 		w.walk(&n.Value)
 		w.visitor.Exit(node)
+	case *ErrorNode:
+		if n.Node != nil {
+			w.walk(&n.Node)
+		}
+		w.visitor.Exit(node)
 	default:
 		panic(fmt.Sprintf("undefined node type (%T)", node))
 	}
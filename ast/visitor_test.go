@@ -53,3 +53,16 @@ func TestWalk_patch(t *testing.T) {
 	assert.IsType(t, &ast.NilNode{}, node.(*ast.BinaryNode).Left)
 	assert.IsType(t, &ast.NilNode{}, node.(*ast.BinaryNode).Right)
 }
+
+func TestWalk_slice(t *testing.T) {
+	var node ast.Node
+	node = &ast.SliceNode{
+		Node: &ast.IdentifierNode{Value: "foo"},
+		From: &ast.IdentifierNode{Value: "bar"},
+		To:   &ast.IdentifierNode{Value: "baz"},
+	}
+
+	visitor := &visitor{}
+	ast.Walk(&node, visitor)
+	assert.Equal(t, []string{"foo", "bar", "baz"}, visitor.identifiers)
+}
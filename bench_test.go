@@ -527,3 +527,87 @@ func (Env) Format(t time.Time) string { return t.Format(time.RFC822) }
 // 	}
 // 	b.StopTimer()
 // }
+
+func Benchmark_typedArithmetic(b *testing.B) {
+	type Env struct {
+		Score  float64
+		Weight float64
+		Level  int
+		Bonus  int
+	}
+	env := Env{Score: 0.75, Weight: 1.5, Level: 12, Bonus: 3}
+
+	program, err := jsexpr.Compile(`Score * Weight + 0.5 > 1.0 && Level * 2 - Bonus >= 20`, jsexpr.TypeCheck(env))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var out interface{}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		out, err = vm.Run(program, env)
+	}
+	b.StopTimer()
+
+	if err != nil {
+		b.Fatal(err)
+	}
+	if !out.(bool) {
+		b.Fail()
+	}
+}
+
+func Benchmark_runBatch(b *testing.B) {
+	type User struct {
+		Age     int    `jsexpr:"age"`
+		Country string `jsexpr:"country"`
+	}
+
+	program, err := jsexpr.Compile(`age >= 18 && country == "US"`, jsexpr.TypeCheck(User{}))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	users := make([]User, 1000)
+	for i := range users {
+		users[i] = User{Age: i % 40, Country: "US"}
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, _, err = jsexpr.RunBatch(program, users, vm.BatchOptions{Workers: 4})
+	}
+	b.StopTimer()
+
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+func Benchmark_runColumnar(b *testing.B) {
+	ages := make([]int64, 1000)
+	countries := make([]string, 1000)
+	for i := range ages {
+		ages[i] = int64(i % 40)
+		countries[i] = "US"
+	}
+	columns := map[string]interface{}{
+		"age":     ages,
+		"country": countries,
+	}
+
+	program, err := jsexpr.Compile(`age >= 18 && country == "US"`, jsexpr.AllowUndefinedVariables())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, err = jsexpr.RunColumnar(program, columns)
+	}
+	b.StopTimer()
+
+	if err != nil {
+		b.Fatal(err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"math"
 	"math/bits"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -72,6 +73,63 @@ func Objs() map[string]interface{} {
 	return objects
 }
 
+// Clock provides current time to Date.now.
+type Clock interface {
+	Now() time.Time
+}
+
+// ObjsWith returns builtin objects with Date.now reading clock and
+// Math.random drawing from source. Nil clock or source keeps the default.
+func ObjsWith(clock Clock, source rand.Source) map[string]interface{} {
+	date := objects["Date"].(dateObject)
+	if clock != nil {
+		date.Now = func() int64 {
+			return clock.Now().UnixNano() / 1_000_000 // Millisecond
+		}
+	}
+	maths := objects["Math"].(mathObject)
+	if source != nil {
+		maths.Random = rand.New(source).Float64
+	}
+	objs := make(map[string]interface{}, len(objects))
+	for name, obj := range objects {
+		objs[name] = obj
+	}
+	objs["Date"] = date
+	objs["Math"] = maths
+	return objs
+}
+
+// SyncSource makes source safe for concurrent use.
+func SyncSource(source rand.Source) rand.Source {
+	if _, ok := source.(*syncSource); ok {
+		return source
+	}
+	return &syncSource{source: source}
+}
+
+type syncSource struct {
+	mu     sync.Mutex
+	source rand.Source
+}
+
+func (s *syncSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source.Int63()
+}
+
+// Unwrap returns source guarded by s.
+func (s *syncSource) Unwrap() rand.Source {
+	return s.source
+}
+
+func (s *syncSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.source.Seed(seed)
+}
+
 type dateObject struct {
 	Now func() int64 `jsexpr:"now"`
 }
@@ -1,7 +1,10 @@
 package builtin
 
 import (
+	"math"
+	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -22,3 +25,28 @@ func TestJSHypotenuse(t *testing.T) {
 	out = jsHypotenuse(1, 1, 1, 1)
 	assert.Equal(t, float64(2), out)
 }
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestObjsWith(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 6e6, time.UTC)
+	objs := ObjsWith(fixedClock(at), rand.NewSource(42))
+
+	assert.Equal(t, at.UnixNano()/1e6, objs["Date"].(dateObject).Now())
+	assert.Len(t, objs, len(Objs()))
+
+	expected := rand.New(rand.NewSource(42))
+	random := objs["Math"].(mathObject).Random
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, expected.Float64(), random())
+	}
+
+	// Defaults are kept.
+	objs = ObjsWith(nil, nil)
+	assert.InDelta(t, time.Now().UnixNano()/1e6, objs["Date"].(dateObject).Now(), 1000)
+	assert.Equal(t, math.Pi, objs["Math"].(mathObject).PI)
+}
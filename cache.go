@@ -0,0 +1,214 @@
+package jsexpr
+
+import (
+	"container/list"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byte-power/jsexpr/conf"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/byte-power/jsexpr/vm"
+)
+
+// Cache is a bounded LRU cache of compiled programs, safe for concurrent use.
+// Programs are keyed by source together with options they are compiled with,
+// so the same source compiled with different env or operators is cached
+// separately. Concurrent misses of the same key compile the program once.
+// Compilation errors are not cached. Clock and random source options are
+// compared by identity, so they should be reused between calls to hit.
+type Cache struct {
+	size  int
+	ttl   time.Duration
+	mu    sync.Mutex
+	lru   *list.List
+	items map[cacheKey]*list.Element
+	calls map[cacheKey]*cacheCall
+}
+
+type cacheKey struct {
+	source      string
+	env         reflect.Type
+	defaultType reflect.Type
+	options     string
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	program *vm.Program
+	expires time.Time
+}
+
+// cacheCall is a compilation in progress, which concurrent misses wait for.
+type cacheCall struct {
+	done    chan struct{}
+	program *vm.Program
+	err     error
+}
+
+// NewCache creates cache holding at most size programs. If ttl is positive,
+// programs are compiled again once ttl has passed since compilation.
+func NewCache(size int, ttl time.Duration) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		size:  size,
+		ttl:   ttl,
+		lru:   list.New(),
+		items: make(map[cacheKey]*list.Element),
+		calls: make(map[cacheKey]*cacheCall),
+	}
+}
+
+// Get returns program compiled from source with given options,
+// compiling it on a miss.
+func (c *Cache) Get(source string, ops ...Option) (*vm.Program, error) {
+	config, err := newConfig(ops)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey{
+		source:      source,
+		env:         reflect.TypeOf(config.Env),
+		defaultType: config.DefaultType,
+		options:     fingerprint(config),
+	}
+
+	c.mu.Lock()
+	if e, ok := c.items[key]; ok {
+		entry := e.Value.(*cacheEntry)
+		if entry.expires.IsZero() || time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(e)
+			c.mu.Unlock()
+			return entry.program, nil
+		}
+		c.remove(e)
+	}
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.program, call.err
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	c.compile(key, call, config)
+	return call.program, call.err
+}
+
+func (c *Cache) compile(key cacheKey, call *cacheCall, config *conf.Config) {
+	// Waiting calls must be released even if compilation panics.
+	call.err = fmt.Errorf("compilation of %q did not finish", key.source)
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		if call.err == nil {
+			entry := &cacheEntry{key: key, program: call.program}
+			if c.ttl > 0 {
+				entry.expires = time.Now().Add(c.ttl)
+			}
+			c.items[key] = c.lru.PushFront(entry)
+			for c.lru.Len() > c.size {
+				c.remove(c.lru.Back())
+			}
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	call.program, call.err = compileSource(key.source, config)
+}
+
+// Len returns number of cached programs.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Purge removes all cached programs.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.items = make(map[cacheKey]*list.Element)
+}
+
+func (c *Cache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.items, e.Value.(*cacheEntry).key)
+}
+
+func compileSource(source string, config *conf.Config) (*vm.Program, error) {
+	tree, err := parser.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return compileTree(tree, config)
+}
+
+// fingerprint describes config fields which affect compiled program,
+// except env type which is a part of cache key itself.
+func fingerprint(config *conf.Config) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "expect=%v optimize=%v strict=%v map=%v", config.Expect, config.Optimize, config.Strict, config.MapEnv)
+	if config.MapEnv {
+		// Types of map env depend on its values.
+		names := make([]string, 0, len(config.Types))
+		for name := range config.Types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, " %v:%v", name, config.Types[name].Type)
+		}
+	}
+	fmt.Fprintf(&b, " operators=%v", map[string][]string(config.Operators))
+	fns := make([]string, 0, len(config.ConstExprFns))
+	for name := range config.ConstExprFns {
+		fns = append(fns, name)
+	}
+	sort.Strings(fns)
+	for _, name := range fns {
+		// Functions are taken from env instance, so env of the same
+		// type may fold constant expressions differently.
+		fmt.Fprintf(&b, " const=%v:%v", name, funcIdentity(config.ConstExprFns[name]))
+	}
+	if len(config.Known) > 0 {
+		fmt.Fprintf(&b, " known=%#v", config.Known)
+	}
+	for _, v := range config.Visitors {
+		fmt.Fprintf(&b, " visitor=%#v", v)
+	}
+	if config.Clock != nil {
+		fmt.Fprintf(&b, " clock=%v", identity(config.Clock))
+	}
+	if source, ok := config.Rand.(interface{ Unwrap() rand.Source }); ok {
+		fmt.Fprintf(&b, " rand=%v", identity(source.Unwrap()))
+	} else if config.Rand != nil {
+		fmt.Fprintf(&b, " rand=%v", identity(config.Rand))
+	}
+	fmt.Fprintf(&b, " stack=%v args=%v", config.CallStack, config.CallArgLimit)
+	return b.String()
+}
+
+// funcIdentity describes function by address of its code.
+func funcIdentity(fn reflect.Value) string {
+	if !fn.IsValid() || fn.Kind() != reflect.Func {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%#x", fn.Pointer())
+}
+
+// identity describes stateful value: pointers by address, other values by contents.
+func identity(v interface{}) string {
+	if reflect.ValueOf(v).Kind() == reflect.Ptr {
+		return fmt.Sprintf("%T(%p)", v, v)
+	}
+	return fmt.Sprintf("%#v", v)
+}
@@ -0,0 +1,130 @@
+package jsexpr_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byte-power/jsexpr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	type Env struct {
+		A int `jsexpr:"a"`
+	}
+	cache := jsexpr.NewCache(10, 0)
+
+	p1, err := cache.Get(`a + 1`, jsexpr.TypeCheck(Env{}))
+	require.NoError(t, err)
+	p2, err := cache.Get(`a + 1`, jsexpr.TypeCheck(Env{A: 42}))
+	require.NoError(t, err)
+	require.Same(t, p1, p2)
+
+	// Options which change program are part of the key.
+	p3, err := cache.Get(`a + 1`, jsexpr.TypeCheck(Env{}), jsexpr.AsFloat64())
+	require.NoError(t, err)
+	require.NotSame(t, p1, p3)
+	p4, err := cache.Get(`a + 1`, jsexpr.TypeCheck(map[string]interface{}{"a": 1}))
+	require.NoError(t, err)
+	require.NotSame(t, p1, p4)
+	p5, err := cache.Get(`a + 1`, jsexpr.TypeCheck(map[string]interface{}{"a": 1.5}))
+	require.NoError(t, err)
+	require.NotSame(t, p4, p5)
+	p6, err := cache.Get(`a + 1`, jsexpr.TypeCheck(Env{}), jsexpr.Optimize(false))
+	require.NoError(t, err)
+	require.NotSame(t, p1, p6)
+	require.Equal(t, 5, cache.Len())
+
+	out, err := jsexpr.Run(p3, Env{A: 1})
+	require.NoError(t, err)
+	require.Equal(t, 2.0, out)
+
+	_, err = cache.Get(`a +`)
+	require.Error(t, err)
+	require.Equal(t, 5, cache.Len())
+
+	cache.Purge()
+	require.Equal(t, 0, cache.Len())
+}
+
+func TestCache_constExpr(t *testing.T) {
+	cache := jsexpr.NewCache(10, 0)
+
+	inc := map[string]interface{}{"fn": func(x int) int { return x + 1 }}
+	mul := map[string]interface{}{"fn": func(x int) int { return x * 100 }}
+
+	p1, err := cache.Get(`fn(2)`, jsexpr.TypeCheck(inc), jsexpr.ConstExpr("fn"))
+	require.NoError(t, err)
+	p2, err := cache.Get(`fn(2)`, jsexpr.TypeCheck(mul), jsexpr.ConstExpr("fn"))
+	require.NoError(t, err)
+	require.NotSame(t, p1, p2)
+
+	out, err := jsexpr.Run(p1, inc)
+	require.NoError(t, err)
+	require.Equal(t, 3, out)
+	out, err = jsexpr.Run(p2, mul)
+	require.NoError(t, err)
+	require.Equal(t, 200, out)
+}
+
+func TestCache_eviction(t *testing.T) {
+	cache := jsexpr.NewCache(2, 0)
+
+	a, err := cache.Get(`1`)
+	require.NoError(t, err)
+	_, err = cache.Get(`2`)
+	require.NoError(t, err)
+
+	// Touch first program, so second one is the least recently used.
+	again, err := cache.Get(`1`)
+	require.NoError(t, err)
+	require.Same(t, a, again)
+
+	_, err = cache.Get(`3`)
+	require.NoError(t, err)
+	require.Equal(t, 2, cache.Len())
+
+	again, err = cache.Get(`1`)
+	require.NoError(t, err)
+	require.Same(t, a, again)
+}
+
+func TestCache_ttl(t *testing.T) {
+	cache := jsexpr.NewCache(10, 20*time.Millisecond)
+
+	a, err := cache.Get(`1`)
+	require.NoError(t, err)
+	again, err := cache.Get(`1`)
+	require.NoError(t, err)
+	require.Same(t, a, again)
+
+	time.Sleep(40 * time.Millisecond)
+
+	again, err = cache.Get(`1`)
+	require.NoError(t, err)
+	require.NotSame(t, a, again)
+}
+
+func TestCache_concurrent(t *testing.T) {
+	cache := jsexpr.NewCache(10, 0)
+
+	var wg sync.WaitGroup
+	programs := make(chan interface{}, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			program, err := cache.Get(`all(1..100, {# > 0})`)
+			require.NoError(t, err)
+			programs <- program
+		}()
+	}
+	wg.Wait()
+	close(programs)
+
+	first := <-programs
+	for program := range programs {
+		require.Same(t, first, program)
+	}
+}
@@ -12,6 +12,46 @@ import (
 )
 
 func Check(tree *parser.Tree, config *conf.Config) (reflect.Type, error) {
+	v := newVisitor(config)
+
+	t := v.visit(tree.Node)
+
+	if err := v.checkExpect(t); err != nil {
+		return nil, err
+	}
+
+	if v.err != nil {
+		return t, v.err.Bind(tree.Source)
+	}
+
+	return t, nil
+}
+
+// Analyze type checks tree like Check, but returns all found
+// problems as diagnostics instead of the first error.
+func Analyze(tree *parser.Tree, config *conf.Config) (reflect.Type, file.Diagnostics) {
+	v := newVisitor(config)
+
+	t := v.visit(tree.Node)
+
+	// Unexpected type of erroneous tree is not a separate problem.
+	if len(v.diagnostics) == 0 {
+		if err := v.checkExpect(t); err != nil {
+			v.diagnostics = append(v.diagnostics, file.Diagnostic{
+				Severity: file.SeverityError,
+				Code:     "unexpected-type",
+				Message:  err.Error(),
+				Location: tree.Node.Location(),
+				Range:    nodeRange(tree.Node),
+			})
+		}
+	}
+	locate(tree.Source, v.diagnostics)
+
+	return t, v.diagnostics
+}
+
+func newVisitor(config *conf.Config) *visitor {
 	v := &visitor{
 		collections: make([]reflect.Type, 0),
 	}
@@ -22,27 +62,23 @@ func Check(tree *parser.Tree, config *conf.Config) (reflect.Type, error) {
 		v.strict = config.Strict
 		v.defaultType = config.DefaultType
 	}
+	return v
+}
 
-	t := v.visit(tree.Node)
-
+func (v *visitor) checkExpect(t reflect.Type) error {
 	if v.expect != reflect.Invalid {
 		switch v.expect {
 		case reflect.Int64, reflect.Float64:
 			if !isNumber(t) {
-				return nil, fmt.Errorf("expected %v, but got %v", v.expect, t)
+				return fmt.Errorf("expected %v, but got %v", v.expect, t)
 			}
 		default:
 			if t.Kind() != v.expect {
-				return nil, fmt.Errorf("expected %v, but got %v", v.expect, t)
+				return fmt.Errorf("expected %v, but got %v", v.expect, t)
 			}
 		}
 	}
-
-	if v.err != nil {
-		return t, v.err.Bind(tree.Source)
-	}
-
-	return t, nil
+	return nil
 }
 
 type visitor struct {
@@ -53,6 +89,7 @@ type visitor struct {
 	strict      bool
 	defaultType reflect.Type
 	err         *file.Error
+	diagnostics file.Diagnostics
 }
 
 func (v *visitor) visit(node ast.Node) reflect.Type {
@@ -100,6 +137,8 @@ func (v *visitor) visit(node ast.Node) reflect.Type {
 		t = v.MapNode(n)
 	case *ast.PairNode:
 		t = v.PairNode(n)
+	case *ast.ErrorNode:
+		t = v.ErrorNode(n)
 	default:
 		panic(fmt.Sprintf("undefined node type (%T)", node))
 	}
@@ -107,13 +146,23 @@ func (v *visitor) visit(node ast.Node) reflect.Type {
 	return t
 }
 
-func (v *visitor) error(node ast.Node, format string, args ...interface{}) reflect.Type {
+func (v *visitor) error(node ast.Node, code, format string, args ...interface{}) reflect.Type {
+	message := fmt.Sprintf(format, args...)
+	r := errorRange(node)
 	if v.err == nil { // show first error
 		v.err = &file.Error{
 			Location: node.Location(),
-			Message:  fmt.Sprintf(format, args...),
+			Range:    r,
+			Message:  message,
 		}
 	}
+	v.diagnostics = append(v.diagnostics, file.Diagnostic{
+		Severity: file.SeverityError,
+		Code:     code,
+		Message:  message,
+		Location: node.Location(),
+		Range:    r,
+	})
 	return interfaceType // interface represent undefined type
 }
 
@@ -127,7 +176,7 @@ func (v *visitor) IdentifierNode(node *ast.IdentifierNode) reflect.Type {
 	}
 	if t, ok := v.types[node.Value]; ok {
 		if t.Ambiguous {
-			return v.error(node, "ambiguous identifier %v", node.Value)
+			return v.error(node, "ambiguous-name", "ambiguous identifier %v", node.Value)
 		}
 		return t.Type
 	}
@@ -137,7 +186,9 @@ func (v *visitor) IdentifierNode(node *ast.IdentifierNode) reflect.Type {
 		}
 		return interfaceType
 	}
-	return v.error(node, "unknown name %v", node.Value)
+	t := v.error(node, "unknown-name", "unknown name %v", node.Value)
+	v.suggest(node.Location(), node.Value, v.names())
+	return t
 }
 
 func (v *visitor) IntegerNode(*ast.IntegerNode) reflect.Type {
@@ -172,10 +223,10 @@ func (v *visitor) UnaryNode(node *ast.UnaryNode) reflect.Type {
 		}
 
 	default:
-		return v.error(node, "unknown operator (%v)", node.Operator)
+		return v.error(node, "unknown-operator", "unknown operator (%v)", node.Operator)
 	}
 
-	return v.error(node, `invalid operation: %v (mismatched type %v)`, node.Operator, t)
+	return v.error(node, "mismatched-types", `invalid operation: %v (mismatched type %v)`, node.Operator, t)
 }
 
 func (v *visitor) BinaryNode(node *ast.BinaryNode) reflect.Type {
@@ -257,11 +308,11 @@ func (v *visitor) BinaryNode(node *ast.BinaryNode) reflect.Type {
 		}
 
 	default:
-		return v.error(node, "unknown operator (%v)", node.Operator)
+		return v.error(node, "unknown-operator", "unknown operator (%v)", node.Operator)
 
 	}
 
-	return v.error(node, `invalid operation: %v (mismatched types %v and %v)`, node.Operator, l, r)
+	return v.error(node, "mismatched-types", `invalid operation: %v (mismatched types %v and %v)`, node.Operator, l, r)
 }
 
 func (v *visitor) MatchesNode(node *ast.MatchesNode) reflect.Type {
@@ -272,7 +323,7 @@ func (v *visitor) MatchesNode(node *ast.MatchesNode) reflect.Type {
 		return boolType
 	}
 
-	return v.error(node, `invalid operation: matches (mismatched types %v and %v)`, l, r)
+	return v.error(node, "mismatched-types", `invalid operation: matches (mismatched types %v and %v)`, l, r)
 }
 
 func (v *visitor) PropertyNode(node *ast.PropertyNode) reflect.Type {
@@ -282,7 +333,9 @@ func (v *visitor) PropertyNode(node *ast.PropertyNode) reflect.Type {
 		return t
 	}
 
-	return v.error(node, "type %v has no field %v", t, node.Property)
+	v.error(node, "unknown-field", "type %v has no field %v", t, node.Property)
+	v.suggest(node.Location(), node.Property, fieldNames(t))
+	return interfaceType
 }
 
 func (v *visitor) IndexNode(node *ast.IndexNode) reflect.Type {
@@ -291,12 +344,12 @@ func (v *visitor) IndexNode(node *ast.IndexNode) reflect.Type {
 
 	if t, ok := indexType(t); ok {
 		if !isInteger(i) && !isString(i) {
-			return v.error(node, "invalid operation: cannot use %v as index to %v", i, t)
+			return v.error(node, "invalid-index", "invalid operation: cannot use %v as index to %v", i, t)
 		}
 		return t
 	}
 
-	return v.error(node, "invalid operation: type %v does not support indexing", t)
+	return v.error(node, "invalid-index", "invalid operation: type %v does not support indexing", t)
 }
 
 func (v *visitor) SliceNode(node *ast.SliceNode) reflect.Type {
@@ -308,22 +361,23 @@ func (v *visitor) SliceNode(node *ast.SliceNode) reflect.Type {
 		if node.From != nil {
 			from := v.visit(node.From)
 			if !isInteger(from) {
-				return v.error(node.From, "invalid operation: non-integer slice index %v", from)
+				return v.error(node.From, "invalid-index", "invalid operation: non-integer slice index %v", from)
 			}
 		}
 		if node.To != nil {
 			to := v.visit(node.To)
 			if !isInteger(to) {
-				return v.error(node.To, "invalid operation: non-integer slice index %v", to)
+				return v.error(node.To, "invalid-index", "invalid operation: non-integer slice index %v", to)
 			}
 		}
 		return t
 	}
 
-	return v.error(node, "invalid operation: cannot slice %v", t)
+	return v.error(node, "invalid-index", "invalid operation: cannot slice %v", t)
 }
 
 func (v *visitor) FunctionNode(node *ast.FunctionNode) reflect.Type {
+	node.Fast = false
 	if f, ok := v.types[node.Name]; ok {
 		if fn, ok := isFuncType(f.Type); ok {
 
@@ -352,7 +406,9 @@ func (v *visitor) FunctionNode(node *ast.FunctionNode) reflect.Type {
 		}
 		return interfaceType
 	}
-	return v.error(node, "unknown func %v", node.Name)
+	t := v.error(node, "unknown-func", "unknown func %v", node.Name)
+	v.suggest(node.Location(), node.Name, v.funcNames())
+	return t
 }
 
 func (v *visitor) MethodNode(node *ast.MethodNode) reflect.Type {
@@ -362,7 +418,9 @@ func (v *visitor) MethodNode(node *ast.MethodNode) reflect.Type {
 			return v.checkFunc(fn, method, node, node.Method, node.Arguments)
 		}
 	}
-	return v.error(node, "type %v has no method %v", t, node.Method)
+	v.error(node, "unknown-method", "type %v has no method %v", t, node.Method)
+	v.suggest(node.Location(), node.Method, methodNames(t))
+	return interfaceType
 }
 
 // checkFunc checks func arguments and returns "return type" of func or method.
@@ -372,10 +430,10 @@ func (v *visitor) checkFunc(fn reflect.Type, method bool, node ast.Node, name st
 	}
 
 	if fn.NumOut() == 0 {
-		return v.error(node, "func %v doesn't return value", name)
+		return v.error(node, "invalid-func", "func %v doesn't return value", name)
 	}
 	if fn.NumOut() != 1 {
-		return v.error(node, "func %v returns more then one value", name)
+		return v.error(node, "invalid-func", "func %v returns more then one value", name)
 	}
 
 	// numIn := fn.NumIn()
@@ -388,14 +446,14 @@ func (v *visitor) checkFunc(fn reflect.Type, method bool, node ast.Node, name st
 
 	// if fn.IsVariadic() {
 	// 	if len(arguments) < numIn-1 {
-	// 		return v.error(node, "not enough arguments to call %v", name)
+	// 		return v.error(node, "invalid-argument", "not enough arguments to call %v", name)
 	// 	}
 	// } else {
 	// 	if len(arguments) > numIn {
-	// 		return v.error(node, "too many arguments to call %v", name)
+	// 		return v.error(node, "invalid-argument", "too many arguments to call %v", name)
 	// 	}
 	// 	if len(arguments) < numIn {
-	// 		return v.error(node, "not enough arguments to call %v", name)
+	// 		return v.error(node, "invalid-argument", "not enough arguments to call %v", name)
 	// 	}
 	// }
 
@@ -429,7 +487,7 @@ func (v *visitor) checkFunc(fn reflect.Type, method bool, node ast.Node, name st
 	// 	}
 
 	// 	if !t.AssignableTo(in) && t.Kind() != reflect.Interface {
-	// 		return v.error(arg, "cannot use %v as argument (type %v) to call %v ", t, in, name)
+	// 		return v.error(arg, "invalid-argument", "cannot use %v as argument (type %v) to call %v ", t, in, name)
 	// 	}
 	// }
 
@@ -444,12 +502,12 @@ func (v *visitor) BuiltinNode(node *ast.BuiltinNode) reflect.Type {
 		if isArray(param) || isMap(param) || isString(param) {
 			return integerType
 		}
-		return v.error(node, "invalid argument for len (type %v)", param)
+		return v.error(node, "invalid-argument", "invalid argument for len (type %v)", param)
 
 	case "all", "none", "any", "one":
 		collection := v.visit(node.Arguments[0])
 		if !isArray(collection) {
-			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
+			return v.error(node.Arguments[0], "invalid-argument", "builtin %v takes only array (got %v)", node.Name, collection)
 		}
 
 		v.collections = append(v.collections, collection)
@@ -461,16 +519,16 @@ func (v *visitor) BuiltinNode(node *ast.BuiltinNode) reflect.Type {
 			closure.NumIn() == 1 && isInterface(closure.In(0)) {
 
 			if !isBool(closure.Out(0)) {
-				return v.error(node.Arguments[1], "closure should return boolean (got %v)", closure.Out(0).String())
+				return v.error(node.Arguments[1], "invalid-argument", "closure should return boolean (got %v)", closure.Out(0).String())
 			}
 			return boolType
 		}
-		return v.error(node.Arguments[1], "closure should has one input and one output param")
+		return v.error(node.Arguments[1], "invalid-argument", "closure should has one input and one output param")
 
 	case "filter":
 		collection := v.visit(node.Arguments[0])
 		if !isArray(collection) {
-			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
+			return v.error(node.Arguments[0], "invalid-argument", "builtin %v takes only array (got %v)", node.Name, collection)
 		}
 
 		v.collections = append(v.collections, collection)
@@ -482,19 +540,19 @@ func (v *visitor) BuiltinNode(node *ast.BuiltinNode) reflect.Type {
 			closure.NumIn() == 1 && isInterface(closure.In(0)) {
 
 			if !isBool(closure.Out(0)) {
-				return v.error(node.Arguments[1], "closure should return boolean (got %v)", closure.Out(0).String())
+				return v.error(node.Arguments[1], "invalid-argument", "closure should return boolean (got %v)", closure.Out(0).String())
 			}
 			if isInterface(collection) {
 				return arrayType
 			}
 			return reflect.SliceOf(collection.Elem())
 		}
-		return v.error(node.Arguments[1], "closure should has one input and one output param")
+		return v.error(node.Arguments[1], "invalid-argument", "closure should has one input and one output param")
 
 	case "map":
 		collection := v.visit(node.Arguments[0])
 		if !isArray(collection) {
-			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
+			return v.error(node.Arguments[0], "invalid-argument", "builtin %v takes only array (got %v)", node.Name, collection)
 		}
 
 		v.collections = append(v.collections, collection)
@@ -507,12 +565,12 @@ func (v *visitor) BuiltinNode(node *ast.BuiltinNode) reflect.Type {
 
 			return reflect.SliceOf(closure.Out(0))
 		}
-		return v.error(node.Arguments[1], "closure should has one input and one output param")
+		return v.error(node.Arguments[1], "invalid-argument", "closure should has one input and one output param")
 
 	case "count":
 		collection := v.visit(node.Arguments[0])
 		if !isArray(collection) {
-			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
+			return v.error(node.Arguments[0], "invalid-argument", "builtin %v takes only array (got %v)", node.Name, collection)
 		}
 
 		v.collections = append(v.collections, collection)
@@ -523,12 +581,12 @@ func (v *visitor) BuiltinNode(node *ast.BuiltinNode) reflect.Type {
 			closure.NumOut() == 1 &&
 			closure.NumIn() == 1 && isInterface(closure.In(0)) {
 			if !isBool(closure.Out(0)) {
-				return v.error(node.Arguments[1], "closure should return boolean (got %v)", closure.Out(0).String())
+				return v.error(node.Arguments[1], "invalid-argument", "closure should return boolean (got %v)", closure.Out(0).String())
 			}
 
 			return integerType
 		}
-		return v.error(node.Arguments[1], "closure should has one input and one output param")
+		return v.error(node.Arguments[1], "invalid-argument", "closure should has one input and one output param")
 
 	default:
 		// if more builtin funcs are coming in the future, or above non-JS builtins are removing
@@ -536,7 +594,9 @@ func (v *visitor) BuiltinNode(node *ast.BuiltinNode) reflect.Type {
 		if _, ok := builtin.Funcs()[node.Name]; ok {
 			return interfaceType
 		}
-		return v.error(node, "unknown builtin %v", node.Name)
+		t := v.error(node, "unknown-func", "unknown builtin %v", node.Name)
+		v.suggest(node.Location(), node.Name, v.funcNames())
+		return t
 	}
 }
 
@@ -547,7 +607,7 @@ func (v *visitor) ClosureNode(node *ast.ClosureNode) reflect.Type {
 
 func (v *visitor) PointerNode(node *ast.PointerNode) reflect.Type {
 	if len(v.collections) == 0 {
-		return v.error(node, "cannot use pointer accessor outside closure")
+		return v.error(node, "invalid-pointer", "cannot use pointer accessor outside closure")
 	}
 
 	collection := v.collections[len(v.collections)-1]
@@ -555,13 +615,13 @@ func (v *visitor) PointerNode(node *ast.PointerNode) reflect.Type {
 	if t, ok := indexType(collection); ok {
 		return t
 	}
-	return v.error(node, "cannot use %v as array", collection)
+	return v.error(node, "invalid-pointer", "cannot use %v as array", collection)
 }
 
 func (v *visitor) ConditionalNode(node *ast.ConditionalNode) reflect.Type {
 	c := v.visit(node.Cond)
 	if !isBool(c) {
-		return v.error(node.Cond, "non-bool expression (type %v) used as condition", c)
+		return v.error(node.Cond, "mismatched-types", "non-bool expression (type %v) used as condition", c)
 	}
 
 	t1 := v.visit(node.Exp1)
@@ -601,3 +661,10 @@ func (v *visitor) PairNode(node *ast.PairNode) reflect.Type {
 	v.visit(node.Value)
 	return nilType
 }
+
+func (v *visitor) ErrorNode(node *ast.ErrorNode) reflect.Type {
+	if node.Node != nil {
+		v.visit(node.Node)
+	}
+	return v.error(node, "syntax", "invalid expression")
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/byte-power/jsexpr"
+	"github.com/byte-power/jsexpr/ast"
 	"github.com/byte-power/jsexpr/checker"
 	"github.com/byte-power/jsexpr/conf"
 	"github.com/byte-power/jsexpr/parser"
@@ -187,17 +188,17 @@ type checker_test.bar has no field Not (1:9)
 Noo
 unknown name Noo (1:1)
  | Noo
- | ^
+ | ^^^
 
 Foo()
 unknown func Foo (1:1)
  | Foo()
- | ^
+ | ^^^
 
 Foo['string']
 invalid operation: type *checker_test.foo does not support indexing (1:4)
  | Foo['string']
- | ...^
+ | ...^^^^^^^^^^
 
 Foo.Fn(Not)
 too many arguments to call Fn (1:5)
@@ -207,7 +208,7 @@ too many arguments to call Fn (1:5)
 Foo.Bar()
 type *checker_test.foo has no method Bar (1:5)
  | Foo.Bar()
- | ....^
+ | ....^^^
 
 Foo.Bar.Not()
 type checker_test.bar has no method Not (1:9)
@@ -217,27 +218,27 @@ type checker_test.bar has no method Not (1:9)
 ArrayOfFoo[0].Not
 type *checker_test.foo has no field Not (1:15)
  | ArrayOfFoo[0].Not
- | ..............^
+ | ..............^^^
 
 ArrayOfFoo[Not]
 unknown name Not (1:12)
  | ArrayOfFoo[Not]
- | ...........^
+ | ...........^^^
 
 Not[0]
 unknown name Not (1:1)
  | Not[0]
- | ^
+ | ^^^
 
 Not.Bar
 unknown name Not (1:1)
  | Not.Bar
- | ^
+ | ^^^
 
 ArrayOfFoo.Not
 type []*checker_test.foo has no field Not (1:12)
  | ArrayOfFoo.Not
- | ...........^
+ | ...........^^^
 
 Fn(Not)
 not enough arguments to call Fn (1:1)
@@ -247,187 +248,187 @@ not enough arguments to call Fn (1:1)
 Map['str'].Not
 type *checker_test.foo has no field Not (1:12)
  | Map['str'].Not
- | ...........^
+ | ...........^^^
 
 Bool && IntPtr
 invalid operation: && (mismatched types bool and *int) (1:6)
  | Bool && IntPtr
- | .....^
+ | .....^^^^^^^^^
 
 No ? Any.Bool : Any.Not
 unknown name No (1:1)
  | No ? Any.Bool : Any.Not
- | ^
+ | ^^
 
 Any.Cond ? No : Any.Not
 unknown name No (1:12)
  | Any.Cond ? No : Any.Not
- | ...........^
+ | ...........^^
 
 Any.Cond ? Any.Bool : No
 unknown name No (1:23)
  | Any.Cond ? Any.Bool : No
- | ......................^
+ | ......................^^
 
 ManOfAny ? Any : Any
 non-bool expression (type map[string]interface {}) used as condition (1:1)
  | ManOfAny ? Any : Any
- | ^
+ | ^^^^^^^^
 
 String matches Int
 invalid operation: matches (mismatched types string and int) (1:8)
  | String matches Int
- | .......^
+ | .......^^^^^^^^^^^
 
 Int matches String
 invalid operation: matches (mismatched types int and string) (1:5)
  | Int matches String
- | ....^
+ | ....^^^^^^^^^^^^^^
 
 String contains Int
 invalid operation: contains (mismatched types string and int) (1:8)
  | String contains Int
- | .......^
+ | .......^^^^^^^^^^^^
 
 Int contains String
 invalid operation: contains (mismatched types int and string) (1:5)
  | Int contains String
- | ....^
+ | ....^^^^^^^^^^^^^^^
 
 !Not
 unknown name Not (1:2)
  | !Not
- | .^
+ | .^^^
 
 Not == Any
 unknown name Not (1:1)
  | Not == Any
- | ^
+ | ^^^
 
 [Not]
 unknown name Not (1:2)
  | [Not]
- | .^
+ | .^^^
 
 {id: Not}
 unknown name Not (1:6)
  | {id: Not}
- | .....^
+ | .....^^^
 
 (nil).Foo
 type <nil> has no field Foo (1:7)
  | (nil).Foo
- | ......^
+ | ......^^^
 
 (nil)['Foo']
 invalid operation: type <nil> does not support indexing (1:6)
  | (nil)['Foo']
- | .....^
+ | .....^^^^^^^
 
 1 and false
 invalid operation: and (mismatched types int and bool) (1:3)
  | 1 and false
- | ..^
+ | ..^^^^^^^^^
 
 true or 0
 invalid operation: or (mismatched types bool and int) (1:6)
  | true or 0
- | .....^
+ | .....^^^^
 
 not IntPtr
 invalid operation: not (mismatched type *int) (1:1)
  | not IntPtr
- | ^
+ | ^^^^^^^^^^
 
 len(Not)
 unknown name Not (1:5)
  | len(Not)
- | ....^
+ | ....^^^
 
 Int < Bool
 invalid operation: < (mismatched types int and bool) (1:5)
  | Int < Bool
- | ....^
+ | ....^^^^^^
 
 Int > Bool
 invalid operation: > (mismatched types int and bool) (1:5)
  | Int > Bool
- | ....^
+ | ....^^^^^^
 
 Int >= Bool
 invalid operation: >= (mismatched types int and bool) (1:5)
  | Int >= Bool
- | ....^
+ | ....^^^^^^^
 
 Int <= Bool
 invalid operation: <= (mismatched types int and bool) (1:5)
  | Int <= Bool
- | ....^
+ | ....^^^^^^^
 
 Int + Bool
 invalid operation: + (mismatched types int and bool) (1:5)
  | Int + Bool
- | ....^
+ | ....^^^^^^
 
 Int - Bool
 invalid operation: - (mismatched types int and bool) (1:5)
  | Int - Bool
- | ....^
+ | ....^^^^^^
 
 Int * Bool
 invalid operation: * (mismatched types int and bool) (1:5)
  | Int * Bool
- | ....^
+ | ....^^^^^^
 
 Int / Bool
 invalid operation: / (mismatched types int and bool) (1:5)
  | Int / Bool
- | ....^
+ | ....^^^^^^
 
 Int % Bool
 invalid operation: % (mismatched types int and bool) (1:5)
  | Int % Bool
- | ....^
+ | ....^^^^^^
 
 Int ** Bool
 invalid operation: ** (mismatched types int and bool) (1:5)
  | Int ** Bool
- | ....^
+ | ....^^^^^^^
 
 Int .. Bool
 invalid operation: .. (mismatched types int and bool) (1:5)
  | Int .. Bool
- | ....^
+ | ....^^^^^^^
 
 NilFn() and BoolFn()
 func NilFn doesn't return value (1:1)
  | NilFn() and BoolFn()
- | ^
+ | ^^^^^
 
 'str' in String
 invalid operation: in (mismatched types string and string) (1:7)
  | 'str' in String
- | ......^
+ | ......^^^^^^^^^
 
 1 in Foo
 invalid operation: in (mismatched types int and *checker_test.foo) (1:3)
  | 1 in Foo
- | ..^
+ | ..^^^^^^
 
 1 + ''
 invalid operation: + (mismatched types int and string) (1:3)
  | 1 + ''
- | ..^
+ | ..^^^^
 
 all(ArrayOfFoo, {#.Fn() < 0})
 invalid operation: < (mismatched types bool and int) (1:25)
  | all(ArrayOfFoo, {#.Fn() < 0})
- | ........................^
+ | ........................^^^
 
 map(Any, {0})[0] + "str"
 invalid operation: + (mismatched types int and string) (1:18)
  | map(Any, {0})[0] + "str"
- | .................^
+ | .................^^^^^^^
 
 Variadic()
 not enough arguments to call Variadic (1:1)
@@ -457,12 +458,12 @@ builtin count takes only array (got int) (1:7)
 count(ArrayOfInt, {#})
 closure should return boolean (got int) (1:19)
  | count(ArrayOfInt, {#})
- | ..................^
+ | ..................^^^
 
 all(ArrayOfInt, {# + 1})
 closure should return boolean (got int) (1:17)
  | all(ArrayOfInt, {# + 1})
- | ................^
+ | ................^^^^^^^
 
 filter(ArrayOfFoo, {.Int64})
 closure should return boolean (got int64) (1:20)
@@ -516,6 +517,52 @@ func TestCheck_AsBool(t *testing.T) {
 	assert.Equal(t, "expected bool, but got int", err.Error())
 }
 
+func TestAnalyze_tolerant(t *testing.T) {
+	tree, _ := parser.ParseTolerant(`Foo.`)
+
+	_, diagnostics := checker.Analyze(tree, conf.New(mockEnv2{}))
+	assert.Len(t, diagnostics, 1)
+	assert.Equal(t, "syntax", diagnostics[0].Code)
+
+	// Operand before error is typed, so editor can complete its fields.
+	partial := tree.Node.(*ast.ErrorNode).Node
+	assert.Equal(t, "*checker_test.foo", partial.Type().String())
+}
+
+func TestAnalyze_suggestions(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		text    string
+	}{
+		{`foo`, "did you mean Foo?", "Foo"},
+		{`strin`, "did you mean String?", "String"},
+		{`Foo.Int64`, "did you mean int64?", "int64"},
+		{`Foo.bar.bax`, "did you mean baz?", "baz"},
+		{`Foo.Fm()`, "did you mean Fn?", "Fn"},
+		{`lenght(ArrayOfInt)`, "did you mean len?", "len"},
+		{`parseint("1")`, "did you mean parseInt?", "parseInt"},
+		{`Metod(1)`, "did you mean method?", "method"},
+		{`Iny`, "did you mean Any or Int?", "Any"},
+	}
+
+	for _, test := range tests {
+		tree, err := parser.Parse(test.input)
+		assert.NoError(t, err, test.input)
+
+		_, diagnostics := checker.Analyze(tree, conf.New(mockEnv2{}))
+		if assert.Len(t, diagnostics, 1, test.input) && assert.NotNil(t, diagnostics[0].Fix, test.input) {
+			assert.Equal(t, test.message, diagnostics[0].Fix.Message, test.input)
+			assert.Equal(t, test.text, diagnostics[0].Fix.Text, test.input)
+		}
+	}
+
+	tree, err := parser.Parse(`xyz`)
+	assert.NoError(t, err)
+	_, diagnostics := checker.Analyze(tree, conf.New(mockEnv2{}))
+	assert.Nil(t, diagnostics[0].Fix)
+}
+
 //
 // Mock types
 //
@@ -0,0 +1,271 @@
+package checker
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/builtin"
+	"github.com/byte-power/jsexpr/file"
+	"github.com/byte-power/jsexpr/utility"
+)
+
+// nodeRange returns part of source spanned by node. Nodes made by patches
+// have no range, it is guessed from the leftmost to the rightmost location
+// of subtree.
+func nodeRange(node ast.Node) file.Range {
+	if r := node.Range(); !r.Empty() {
+		return r
+	}
+	r := &rangeVisitor{}
+	ast.Walk(&node, r)
+	return r.Range
+}
+
+// errorRange returns part of source to report error of node at.
+// Errors of names point to the name itself.
+func errorRange(node ast.Node) file.Range {
+	switch node.(type) {
+	case *ast.IdentifierNode, *ast.PropertyNode, *ast.MethodNode, *ast.FunctionNode, *ast.BuiltinNode:
+		start := node.Location()
+		end := start
+		end.Column += tokenWidth(node)
+		return file.Range{Start: start, End: end}
+	}
+	return nodeRange(node)
+}
+
+// locate sets offsets of diagnostic ranges, which are made of node
+// locations, from source.
+func locate(source *file.Source, diagnostics file.Diagnostics) {
+	if source == nil {
+		return
+	}
+	for i, d := range diagnostics {
+		diagnostics[i].Range = source.Range(d.Range.Start, d.Range.End)
+		if d.Fix != nil {
+			d.Fix.Range = source.Range(d.Fix.Range.Start, d.Fix.Range.End)
+		}
+	}
+}
+
+type rangeVisitor struct {
+	file.Range
+	found bool
+}
+
+func (r *rangeVisitor) Enter(node *ast.Node) {}
+
+func (r *rangeVisitor) Exit(node *ast.Node) {
+	loc := (*node).Location()
+	if loc.Empty() {
+		return
+	}
+	end := loc
+	end.Column += tokenWidth(*node)
+	if !r.found || before(loc, r.Start) {
+		r.Start = loc
+	}
+	if !r.found || before(r.End, end) {
+		r.End = end
+	}
+	r.found = true
+}
+
+func before(a, b file.Location) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// tokenWidth returns width of token at location of node.
+func tokenWidth(node ast.Node) int {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		return utf8.RuneCountInString(n.Value)
+	case *ast.PropertyNode:
+		return utf8.RuneCountInString(n.Property)
+	case *ast.MethodNode:
+		return utf8.RuneCountInString(n.Method)
+	case *ast.FunctionNode:
+		return utf8.RuneCountInString(n.Name)
+	case *ast.BuiltinNode:
+		return utf8.RuneCountInString(n.Name)
+	case *ast.BinaryNode:
+		return utf8.RuneCountInString(n.Operator)
+	case *ast.UnaryNode:
+		return utf8.RuneCountInString(n.Operator)
+	case *ast.MatchesNode:
+		return len("matches")
+	case *ast.NilNode, *ast.IntegerNode, *ast.FloatNode, *ast.BoolNode, *ast.StringNode:
+		return utf8.RuneCountInString(ast.Print(n))
+	}
+	return 1
+}
+
+// maxSuggestions is the most of candidates suggested for unknown name.
+const maxSuggestions = 3
+
+// builtins are names of builtins parsed as BuiltinNode.
+var builtins = []string{"all", "any", "count", "filter", "len", "map", "none", "one"}
+
+// suggest attaches fix to the last diagnostic, replacing name with
+// the closest of candidates.
+func (v *visitor) suggest(loc file.Location, name string, candidates []string) {
+	closest := closest(name, candidates)
+	if len(closest) == 0 {
+		return
+	}
+	end := loc
+	end.Column += utf8.RuneCountInString(name)
+	v.diagnostics[len(v.diagnostics)-1].Fix = &file.Fix{
+		Message: fmt.Sprintf("did you mean %v?", enumerate(closest)),
+		Range:   file.Range{Start: loc, End: end},
+		Text:    closest[0],
+	}
+}
+
+// closest returns candidates with the least edit distance to name, ignoring
+// case, so names differing only in case are always the closest. Candidates
+// are too far if more than third of name has to be edited.
+func closest(name string, candidates []string) []string {
+	n := utf8.RuneCountInString(name)
+	limit := n/3 + 1
+	if limit >= n {
+		limit = n - 1
+	}
+	var out []string
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if c == "" || c == name || seen[c] {
+			continue
+		}
+		seen[c] = true
+		d := distance(strings.ToLower(name), strings.ToLower(c))
+		if d > limit {
+			continue
+		}
+		if d < limit {
+			limit = d
+			out = out[:0]
+		}
+		out = append(out, c)
+	}
+	sort.Strings(out)
+	if len(out) > maxSuggestions {
+		out = out[:maxSuggestions]
+	}
+	return out
+}
+
+// distance returns number of inserted, deleted, replaced or transposed
+// runes needed to change a into b.
+func distance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = least(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = least(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func least(x int, ys ...int) int {
+	for _, y := range ys {
+		if y < x {
+			x = y
+		}
+	}
+	return x
+}
+
+// enumerate joins names like "a, b or c".
+func enumerate(names []string) string {
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// names returns names defined in env.
+func (v *visitor) names() []string {
+	names := make([]string, 0, len(v.types))
+	for name := range v.types {
+		names = append(names, name)
+	}
+	return names
+}
+
+// funcNames returns names of functions defined in env and builtins.
+func (v *visitor) funcNames() []string {
+	var names []string
+	for name, t := range v.types {
+		if _, ok := isFuncType(t.Type); ok {
+			names = append(names, name)
+		}
+	}
+	names = append(names, builtins...)
+	for name := range builtin.Funcs() {
+		names = append(names, name)
+	}
+	return names
+}
+
+// fieldNames returns names of fields of struct t, including embedded ones.
+func fieldNames(t reflect.Type) []string {
+	t = dereference(t)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			names = append(names, fieldNames(f.Type)...)
+			continue
+		}
+		names = append(names, utility.GetFieldTagName(f))
+	}
+	return names
+}
+
+// methodNames returns names of methods of t and fields of func type,
+// including embedded ones.
+func methodNames(t reflect.Type) []string {
+	if t == nil {
+		return nil
+	}
+	var names []string
+	for i := 0; i < t.NumMethod(); i++ {
+		names = append(names, utility.StrToLowerCamel(t.Method(i).Name))
+	}
+	d := dereference(t)
+	if d.Kind() != reflect.Struct {
+		return names
+	}
+	for i := 0; i < d.NumField(); i++ {
+		f := d.Field(i)
+		if f.Anonymous {
+			names = append(names, methodNames(f.Type)...)
+		} else if f.Type.Kind() == reflect.Func {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/byte-power/jsexpr/checker"
+	"github.com/byte-power/jsexpr/compiler"
+	"github.com/byte-power/jsexpr/optimizer"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/byte-power/jsexpr/vm"
+	"github.com/sanity-io/litter"
+)
+
+// Minimal implementation of Debug Adapter Protocol
+// (https://microsoft.github.io/debug-adapter-protocol/) on top of vm.Debugger.
+// Program runs in a single thread with a single stack frame, variables
+// are grouped into "Stack", "Scope" and "Env" scopes.
+
+const (
+	dapThread      = 1
+	dapFrame       = 1
+	dapStackScope  = 1
+	dapClosureVars = 2
+	dapEnvScope    = 3
+)
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Command    string      `json:"command"`
+	Success    bool        `json:"success"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapBreakpoint struct {
+	Line   int `json:"line"`
+	Column int `json:"column,omitempty"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type dapLaunchArguments struct {
+	Program     string `json:"program"`
+	Expression  string `json:"expression"`
+	Env         string `json:"env"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+}
+
+type dapServer struct {
+	in       *textproto.Reader
+	out      io.Writer
+	seq      int
+	source   dapSource
+	launch   dapLaunchArguments
+	env      interface{}
+	program  *vm.Program
+	debugger *vm.Debugger
+}
+
+func startDAP(in io.Reader, out io.Writer) {
+	s := &dapServer{
+		in:  textproto.NewReader(bufio.NewReader(in)),
+		out: out,
+	}
+	for {
+		req, err := s.read()
+		if err == io.EOF {
+			return
+		}
+		check(err)
+		if !s.handle(req) {
+			return
+		}
+	}
+}
+
+func (s *dapServer) read() (*dapRequest, error) {
+	headers, err := s.in.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length header: %v", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in.R, body); err != nil {
+		return nil, err
+	}
+	req := &dapRequest{}
+	return req, json.Unmarshal(body, req)
+}
+
+func (s *dapServer) write(message interface{}) {
+	b, err := json.Marshal(message)
+	check(err)
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	check(err)
+}
+
+func (s *dapServer) respond(req *dapRequest, body interface{}) {
+	s.seq++
+	s.write(dapResponse{
+		Seq:        s.seq,
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Command:    req.Command,
+		Success:    true,
+		Body:       body,
+	})
+}
+
+func (s *dapServer) fail(req *dapRequest, format string, args ...interface{}) {
+	s.seq++
+	s.write(dapResponse{
+		Seq:        s.seq,
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Command:    req.Command,
+		Message:    fmt.Sprintf(format, args...),
+	})
+}
+
+func (s *dapServer) event(event string, body interface{}) {
+	s.seq++
+	s.write(dapEvent{
+		Seq:   s.seq,
+		Type:  "event",
+		Event: event,
+		Body:  body,
+	})
+}
+
+// handle processes request, it returns false when session is over.
+func (s *dapServer) handle(req *dapRequest) bool {
+	switch req.Command {
+	case "initialize":
+		s.respond(req, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsTerminateRequest":         true,
+		})
+		s.event("initialized", nil)
+
+	case "launch":
+		if s.debugger != nil {
+			// Relaunch abandons previous run.
+			s.debugger.Stop()
+			s.debugger = nil
+		}
+		s.launch, s.env = dapLaunchArguments{}, nil
+		if err := json.Unmarshal(req.Arguments, &s.launch); err != nil {
+			s.fail(req, "%v", err)
+			return true
+		}
+		if err := s.compile(); err != nil {
+			s.fail(req, "%v", err)
+			return true
+		}
+		s.respond(req, nil)
+
+	case "setBreakpoints":
+		s.setBreakpoints(req)
+
+	case "configurationDone":
+		s.respond(req, nil)
+		if s.debugger == nil {
+			return true
+		}
+		if s.launch.StopOnEntry {
+			s.proceed(s.debugger.Step(), "entry")
+		} else {
+			s.proceed(s.debugger.Continue(), "breakpoint")
+		}
+
+	case "threads":
+		s.respond(req, map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": dapThread, "name": "main"}},
+		})
+
+	case "stackTrace":
+		s.stackTrace(req)
+
+	case "scopes":
+		s.respond(req, map[string]interface{}{
+			"scopes": []map[string]interface{}{
+				{"name": "Stack", "variablesReference": dapStackScope, "expensive": false},
+				{"name": "Scope", "variablesReference": dapClosureVars, "expensive": false},
+				{"name": "Env", "variablesReference": dapEnvScope, "expensive": false},
+			},
+		})
+
+	case "variables":
+		s.variables(req)
+
+	case "continue":
+		if !s.running(req) {
+			return true
+		}
+		s.respond(req, map[string]interface{}{"allThreadsContinued": true})
+		s.proceed(s.debugger.Continue(), "breakpoint")
+
+	case "next":
+		if !s.running(req) {
+			return true
+		}
+		s.respond(req, nil)
+		s.proceed(s.debugger.StepOver(), "step")
+
+	case "stepIn":
+		if !s.running(req) {
+			return true
+		}
+		s.respond(req, nil)
+		s.proceed(s.debugger.Step(), "step")
+
+	case "disconnect", "terminate":
+		if s.debugger != nil {
+			s.debugger.Stop()
+		}
+		s.respond(req, nil)
+		return req.Command != "disconnect"
+
+	default:
+		s.fail(req, "unsupported request %v", req.Command)
+	}
+	return true
+}
+
+func (s *dapServer) compile() error {
+	code := s.launch.Expression
+	if s.launch.Program != "" {
+		b, err := ioutil.ReadFile(s.launch.Program)
+		if err != nil {
+			return err
+		}
+		code = string(b)
+		s.source = dapSource{Name: filepath.Base(s.launch.Program), Path: s.launch.Program}
+	} else {
+		s.source = dapSource{Name: "expression"}
+	}
+
+	if s.launch.Env != "" {
+		env, err := loadEnv(s.launch.Env)
+		if err != nil {
+			return err
+		}
+		s.env = env
+	}
+
+	tree, err := parser.Parse(code)
+	if err != nil {
+		return err
+	}
+	if _, err = checker.Check(tree, config(s.env)); err != nil {
+		return err
+	}
+	if opt {
+		if err = optimizer.Optimize(&tree.Node, nil); err != nil {
+			return err
+		}
+	}
+	s.program, err = compiler.Compile(tree, config(s.env))
+	if err != nil {
+		return err
+	}
+	s.debugger = vm.NewDebugger(s.program, s.env)
+	return nil
+}
+
+func (s *dapServer) setBreakpoints(req *dapRequest) {
+	var args struct {
+		Breakpoints []dapBreakpoint `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.fail(req, "%v", err)
+		return
+	}
+	if s.debugger == nil {
+		s.fail(req, "program is not launched")
+		return
+	}
+
+	s.debugger.ClearAll()
+	result := make([]map[string]interface{}, 0, len(args.Breakpoints))
+	for _, bp := range args.Breakpoints {
+		column := bp.Column - 1 // DAP columns are 1-based.
+		ip, err := s.debugger.BreakAt(bp.Line, column)
+		if err != nil {
+			result = append(result, map[string]interface{}{"verified": false, "message": err.Error()})
+			continue
+		}
+		loc := s.program.Locations[ip]
+		result = append(result, map[string]interface{}{
+			"verified": true,
+			"line":     loc.Line,
+			"column":   loc.Column + 1,
+		})
+	}
+	s.respond(req, map[string]interface{}{"breakpoints": result})
+}
+
+// running reports whether program is launched and not finished yet,
+// otherwise it fails request.
+func (s *dapServer) running(req *dapRequest) bool {
+	if s.debugger == nil {
+		s.fail(req, "program is not launched")
+		return false
+	}
+	if s.debugger.Done() {
+		s.fail(req, "program is not running")
+		return false
+	}
+	return true
+}
+
+// proceed reports result of execution control request to the client.
+func (s *dapServer) proceed(paused bool, reason string) {
+	if paused {
+		s.event("stopped", map[string]interface{}{
+			"reason":            reason,
+			"threadId":          dapThread,
+			"allThreadsStopped": true,
+		})
+		return
+	}
+	out, err := s.debugger.Result()
+	exitCode := 0
+	if err != nil {
+		exitCode = 1
+		s.event("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+	} else {
+		s.event("output", map[string]interface{}{"category": "stdout", "output": litter.Sdump(out) + "\n"})
+	}
+	s.event("exited", map[string]interface{}{"exitCode": exitCode})
+	s.event("terminated", nil)
+}
+
+func (s *dapServer) stackTrace(req *dapRequest) {
+	if s.debugger == nil || s.debugger.Done() {
+		s.respond(req, map[string]interface{}{"stackFrames": []interface{}{}, "totalFrames": 0})
+		return
+	}
+	ip := s.debugger.IP()
+	loc := s.debugger.Location()
+	name := fmt.Sprintf("%v %v", ip, vm.OpcodeName(s.program.Bytecode[ip]))
+	s.respond(req, map[string]interface{}{
+		"stackFrames": []map[string]interface{}{{
+			"id":     dapFrame,
+			"name":   name,
+			"source": s.source,
+			"line":   loc.Line,
+			"column": loc.Column + 1,
+		}},
+		"totalFrames": 1,
+	})
+}
+
+func (s *dapServer) variables(req *dapRequest) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.fail(req, "%v", err)
+		return
+	}
+	if s.debugger == nil {
+		s.fail(req, "program is not launched")
+		return
+	}
+
+	variables := make([]dapVariable, 0)
+	switch args.VariablesReference {
+	case dapStackScope:
+		stack := s.debugger.Stack()
+		for i := len(stack) - 1; i >= 0; i-- {
+			variables = append(variables, dapVariable{Name: strconv.Itoa(i), Value: formatValue(stack[i])})
+		}
+
+	case dapClosureVars:
+		scopes := s.debugger.Scopes()
+		for depth := len(scopes) - 1; depth >= 0; depth-- {
+			prefix := strings.Repeat("^", len(scopes)-1-depth)
+			for _, name := range sortedKeys(scopes[depth]) {
+				variables = append(variables, dapVariable{Name: prefix + name, Value: formatValue(scopes[depth][name])})
+			}
+		}
+
+	case dapEnvScope:
+		if env, ok := s.env.(map[string]interface{}); ok {
+			for _, name := range sortedKeys(env) {
+				variables = append(variables, dapVariable{Name: name, Value: formatValue(env[name])})
+			}
+		}
+	}
+	s.respond(req, map[string]interface{}{"variables": variables})
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprintf("%v", v)
+}
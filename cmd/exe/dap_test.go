@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type dapMessage struct {
+	Type       string                 `json:"type"`
+	RequestSeq int                    `json:"request_seq"`
+	Command    string                 `json:"command"`
+	Success    bool                   `json:"success"`
+	Message    string                 `json:"message"`
+	Event      string                 `json:"event"`
+	Body       map[string]interface{} `json:"body"`
+}
+
+// dapSession runs server over requests and returns messages it wrote.
+func dapSession(t *testing.T, requests ...string) []dapMessage {
+	var in bytes.Buffer
+	for i, r := range requests {
+		body := fmt.Sprintf(`{"seq": %d, "type": "request", %s}`, i+1, r)
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	var out bytes.Buffer
+	startDAP(&in, &out)
+
+	var messages []dapMessage
+	reader := textproto.NewReader(bufio.NewReader(&out))
+	for {
+		headers, err := reader.ReadMIMEHeader()
+		if err == io.EOF {
+			return messages
+		}
+		require.NoError(t, err)
+		length, err := strconv.Atoi(headers.Get("Content-Length"))
+		require.NoError(t, err)
+		body := make([]byte, length)
+		_, err = io.ReadFull(reader.R, body)
+		require.NoError(t, err)
+
+		var m dapMessage
+		require.NoError(t, json.Unmarshal(body, &m))
+		messages = append(messages, m)
+	}
+}
+
+func summary(messages []dapMessage) []string {
+	out := make([]string, len(messages))
+	for i, m := range messages {
+		switch {
+		case m.Type == "event":
+			out[i] = "event " + m.Event
+		case m.Success:
+			out[i] = "response " + m.Command
+		default:
+			out[i] = "failed " + m.Command + ": " + m.Message
+		}
+	}
+	return out
+}
+
+func TestDAP(t *testing.T) {
+	messages := dapSession(t,
+		`"command": "initialize"`,
+		`"command": "launch", "arguments": {"expression": "1 + 2", "stopOnEntry": true}`,
+		`"command": "configurationDone"`,
+		`"command": "stackTrace"`,
+		`"command": "variables", "arguments": {"variablesReference": 1}`,
+		`"command": "continue"`,
+		`"command": "disconnect"`,
+	)
+	require.Equal(t, []string{
+		"response initialize",
+		"event initialized",
+		"response launch",
+		"response configurationDone",
+		"event stopped",
+		"response stackTrace",
+		"response variables",
+		"response continue",
+		"event output",
+		"event exited",
+		"event terminated",
+		"response disconnect",
+	}, summary(messages))
+
+	require.Equal(t, "entry", messages[4].Body["reason"])
+	require.Equal(t, 1.0, messages[5].Body["totalFrames"])
+	require.Equal(t, "3\n", messages[8].Body["output"])
+	require.Equal(t, 0.0, messages[9].Body["exitCode"])
+}
+
+func TestDAP_finished(t *testing.T) {
+	messages := dapSession(t,
+		`"command": "initialize"`,
+		`"command": "launch", "arguments": {"expression": "1 + 2"}`,
+		`"command": "configurationDone"`,
+		`"command": "continue"`,
+		`"command": "next"`,
+		`"command": "stepIn"`,
+		`"command": "launch", "arguments": {"expression": "3 * 4", "stopOnEntry": true}`,
+		`"command": "configurationDone"`,
+		`"command": "launch", "arguments": {"expression": "5"}`,
+		`"command": "configurationDone"`,
+		`"command": "disconnect"`,
+	)
+	require.Equal(t, []string{
+		"response initialize",
+		"event initialized",
+		"response launch",
+		"response configurationDone",
+		"event output",
+		"event exited",
+		"event terminated",
+		"failed continue: program is not running",
+		"failed next: program is not running",
+		"failed stepIn: program is not running",
+		"response launch",
+		"response configurationDone",
+		"event stopped",
+		"response launch",
+		"response configurationDone",
+		"event output",
+		"event exited",
+		"event terminated",
+		"response disconnect",
+	}, summary(messages))
+	require.Equal(t, "5\n", messages[15].Body["output"])
+}
+
+func TestDAP_not_launched(t *testing.T) {
+	messages := dapSession(t,
+		`"command": "initialize"`,
+		`"command": "launch", "arguments": {"expression": "1 +"}`,
+		`"command": "continue"`,
+		`"command": "next"`,
+		`"command": "stepIn"`,
+		`"command": "variables", "arguments": {"variablesReference": 1}`,
+		`"command": "setBreakpoints", "arguments": {"breakpoints": [{"line": 1}]}`,
+		`"command": "disconnect"`,
+	)
+	summaries := summary(messages)
+	require.Equal(t, "response initialize", summaries[0])
+	require.True(t, strings.HasPrefix(summaries[2], "failed launch: unexpected token EOF"), summaries[2])
+	require.Equal(t, []string{
+		"failed continue: program is not launched",
+		"failed next: program is not launched",
+		"failed stepIn: program is not launched",
+		"failed variables: program is not launched",
+		"failed setBreakpoints: program is not launched",
+		"response disconnect",
+	}, summaries[3:])
+}
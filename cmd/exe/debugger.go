@@ -21,7 +21,8 @@ func debugger() {
 	tree, err := parser.Parse(input())
 	check(err)
 
-	_, err = checker.Check(tree, nil)
+	env := env()
+	_, err = checker.Check(tree, config(env))
 	check(err)
 
 	if opt {
@@ -29,7 +30,7 @@ func debugger() {
 		check(err)
 	}
 
-	program, err := compiler.Compile(tree, nil)
+	program, err := compiler.Compile(tree, config(env))
 	check(err)
 
 	vm := Debug()
@@ -54,7 +55,7 @@ func debugger() {
 	app.SetRoot(flex, true)
 
 	go func() {
-		out, _ := vm.Run(program, nil)
+		out, _ := vm.Run(program, env)
 		app.QueueUpdateDraw(func() {
 			sub.RemoveItem(scope)
 			result := tview.NewTextView()
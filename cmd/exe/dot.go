@@ -137,6 +137,15 @@ func (v *visitor) Exit(ref *Node) {
 	case *PointerNode:
 		v.push("#")
 
+	case *ErrorNode:
+		if node.Node != nil {
+			a := v.pop()
+			v.push(fmt.Sprintf("%T", node))
+			v.link(a)
+		} else {
+			v.push(fmt.Sprintf("%T", node))
+		}
+
 	case *ConditionalNode:
 		e2 := v.pop()
 		e1 := v.pop()
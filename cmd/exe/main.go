@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -11,6 +12,8 @@ import (
 	"github.com/byte-power/jsexpr/ast"
 	"github.com/byte-power/jsexpr/checker"
 	"github.com/byte-power/jsexpr/compiler"
+	"github.com/byte-power/jsexpr/conf"
+	"github.com/byte-power/jsexpr/lint"
 	"github.com/byte-power/jsexpr/optimizer"
 	"github.com/byte-power/jsexpr/parser"
 	"github.com/byte-power/jsexpr/vm"
@@ -26,6 +29,10 @@ var (
 	repl      bool
 	opt       bool
 	typeCheck bool
+	dap       bool
+	plint     bool
+	envFile   string
+	lintFile  string
 )
 
 func init() {
@@ -37,6 +44,10 @@ func init() {
 	flag.BoolVar(&repl, "repl", false, "start repl")
 	flag.BoolVar(&opt, "opt", true, "do optimization")
 	flag.BoolVar(&typeCheck, "type", true, "do a type check")
+	flag.BoolVar(&dap, "dap", false, "start debug adapter protocol server on stdio")
+	flag.StringVar(&envFile, "env", "", "json file with environment")
+	flag.BoolVar(&plint, "lint", false, "lint program")
+	flag.StringVar(&lintFile, "lint-config", "", "json file with lint config")
 }
 
 func main() {
@@ -62,6 +73,14 @@ func main() {
 		startRepl()
 		os.Exit(0)
 	}
+	if dap {
+		startDAP(os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	if plint {
+		lintProgram()
+		os.Exit(0)
+	}
 
 	flag.Usage()
 	os.Exit(2)
@@ -75,6 +94,50 @@ func input() string {
 	return string(b)
 }
 
+// env loads environment from json file, it returns nil if no file specified.
+func env() interface{} {
+	if envFile == "" {
+		return nil
+	}
+	env, err := loadEnv(envFile)
+	check(err)
+	return env
+}
+
+func loadEnv(path string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]interface{})
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, fmt.Errorf("cannot load env from %v: %v", path, err)
+	}
+	return env, nil
+}
+
+// lintConfig loads lint config from json file, it returns nil if no file specified.
+func lintConfig() *lint.Config {
+	if lintFile == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(lintFile)
+	check(err)
+	config := &lint.Config{}
+	if err := json.Unmarshal(b, config); err != nil {
+		check(fmt.Errorf("cannot load lint config from %v: %v", lintFile, err))
+	}
+	return config
+}
+
+// config creates compiler config for environment, nil env means no config.
+func config(env interface{}) *conf.Config {
+	if env == nil {
+		return nil
+	}
+	return conf.New(env)
+}
+
 func check(err error) {
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -87,7 +150,7 @@ func printAst() {
 	check(err)
 
 	if typeCheck {
-		_, err = checker.Check(tree, nil)
+		_, err = checker.Check(tree, config(env()))
 		check(err)
 
 		if opt {
@@ -103,12 +166,33 @@ func printAst() {
 	dotAst(tree.Node)
 }
 
+func lintProgram() {
+	tree, err := parser.Parse(input())
+	check(err)
+
+	if typeCheck {
+		_, err = checker.Check(tree, config(env()))
+		check(err)
+	}
+
+	diagnostics, err := lint.Lint(tree, lintConfig())
+	check(err)
+
+	if len(diagnostics) > 0 {
+		fmt.Println(diagnostics.Format(tree.Source))
+	}
+	if diagnostics.HasErrors() {
+		os.Exit(1)
+	}
+}
+
 func printDisassemble() {
 	tree, err := parser.Parse(input())
 	check(err)
 
+	env := env()
 	if typeCheck {
-		_, err = checker.Check(tree, nil)
+		_, err = checker.Check(tree, config(env))
 		check(err)
 
 		if opt {
@@ -117,7 +201,7 @@ func printDisassemble() {
 		}
 	}
 
-	program, err := compiler.Compile(tree, nil)
+	program, err := compiler.Compile(tree, config(env))
 	check(err)
 
 	_, _ = fmt.Fprintf(os.Stdout, program.Disassemble())
@@ -127,8 +211,9 @@ func runProgram() {
 	tree, err := parser.Parse(input())
 	check(err)
 
+	env := env()
 	if typeCheck {
-		_, err = checker.Check(tree, nil)
+		_, err = checker.Check(tree, config(env))
 		check(err)
 
 		if opt {
@@ -137,22 +222,23 @@ func runProgram() {
 		}
 	}
 
-	program, err := compiler.Compile(tree, nil)
+	program, err := compiler.Compile(tree, config(env))
 	check(err)
 
-	out, err := vm.Run(program, nil)
+	out, err := vm.Run(program, env)
 	check(err)
 
 	litter.Dump(out)
 }
 
 func startRepl() {
+	env := env()
 	scanner := bufio.NewScanner(os.Stdin)
 	fmt.Print("> ")
 
 	for scanner.Scan() {
 		line := scanner.Text()
-		out, err := jsexpr.Eval(line, nil)
+		out, err := jsexpr.Eval(line, env)
 		if err != nil {
 			fmt.Printf("%v\n", err)
 			goto prompt
@@ -0,0 +1,64 @@
+package columnar
+
+import "math/bits"
+
+// Bitmap is a set of selected rows.
+type Bitmap struct {
+	words []uint64
+	size  int
+}
+
+// NewBitmap creates empty bitmap for size rows.
+func NewBitmap(size int) *Bitmap {
+	return &Bitmap{
+		words: make([]uint64, (size+63)/64),
+		size:  size,
+	}
+}
+
+// NewBitmapOf creates bitmap with rows selected where values are true.
+func NewBitmapOf(values []bool) *Bitmap {
+	b := NewBitmap(len(values))
+	for i, v := range values {
+		if v {
+			b.words[i/64] |= 1 << uint(i%64)
+		}
+	}
+	return b
+}
+
+// Len returns number of rows.
+func (b *Bitmap) Len() int {
+	return b.size
+}
+
+// Get reports whether row i is selected.
+func (b *Bitmap) Get(i int) bool {
+	return b.words[i/64]&(1<<uint(i%64)) != 0
+}
+
+// Set selects row i.
+func (b *Bitmap) Set(i int) {
+	b.words[i/64] |= 1 << uint(i%64)
+}
+
+// Count returns number of selected rows.
+func (b *Bitmap) Count() int {
+	n := 0
+	for _, w := range b.words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Rows returns indexes of selected rows in ascending order.
+func (b *Bitmap) Rows() []int {
+	out := make([]int, 0, b.Count())
+	for i, w := range b.words {
+		for w != 0 {
+			out = append(out, i*64+bits.TrailingZeros64(w))
+			w &= w - 1
+		}
+	}
+	return out
+}
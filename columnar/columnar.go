@@ -0,0 +1,650 @@
+package columnar
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/compiler"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/byte-power/jsexpr/vm"
+)
+
+// Run evaluates program over columns of data. Every column is a slice
+// (of integers, floats, strings, bools or interface{}) holding values
+// of a variable for all rows, all columns must have the same length.
+// Values of other types are used as is for every row (for example functions).
+//
+// Arithmetic, comparisons and logical operators are applied to whole columns.
+// Other nodes, as well as "and" and "or" which right side can not be
+// vectorized, are evaluated row by row with vm.
+//
+// Result is a Bitmap of selected rows for boolean expressions, or a column
+// of []int64, []float64, []string or []interface{} type.
+func Run(program *vm.Program, columns map[string]interface{}) (out interface{}, err error) {
+	if program == nil {
+		return nil, fmt.Errorf("program is nil")
+	}
+	if len(program.Spans) == 0 {
+		return nil, fmt.Errorf("program has no node spans, it should be compiled from source")
+	}
+
+	e := &evaluator{
+		source:  program,
+		raw:     columns,
+		columns: make(map[string]interface{}),
+		size:    -1,
+	}
+	for name, column := range columns {
+		typed, ok, err := normalize(column)
+		if err != nil {
+			return nil, fmt.Errorf("column %v: %v", name, err)
+		}
+		if !ok {
+			if i, ok := column.(int); ok {
+				e.columns[name] = scalar{int64(i)}
+			} else {
+				e.columns[name] = scalar{column}
+			}
+			continue
+		}
+		n := reflect.ValueOf(typed).Len()
+		if e.size >= 0 && n != e.size {
+			return nil, fmt.Errorf("column %v has %v rows, expected %v", name, n, e.size)
+		}
+		e.size = n
+		e.columns[name] = typed
+	}
+	if e.size < 0 {
+		e.size = 0
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	out, _ = e.eval(program.Spans[0].Node, false)
+	out = e.column(out)
+	if b, ok := out.([]bool); ok {
+		return NewBitmapOf(b), nil
+	}
+	return out, nil
+}
+
+type evaluator struct {
+	source  *vm.Program
+	raw     map[string]interface{}
+	columns map[string]interface{}
+	size    int
+}
+
+// scalar is a value which is the same for every row.
+type scalar struct {
+	value interface{}
+}
+
+// normalize converts column of other numeric type to []int64 or []float64,
+// it returns false if column is not a column, but a scalar.
+func normalize(column interface{}) (interface{}, bool, error) {
+	switch c := column.(type) {
+	case []int64, []float64, []string, []bool, []interface{}:
+		return c, true, nil
+	case []int:
+		ints := make([]int64, len(c))
+		for i, v := range c {
+			ints[i] = int64(v)
+		}
+		return ints, true, nil
+	}
+
+	v := reflect.ValueOf(column)
+	if v.Kind() != reflect.Slice {
+		return nil, false, nil
+	}
+	switch v.Type().Elem().Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		ints := make([]int64, v.Len())
+		for i := range ints {
+			ints[i] = v.Index(i).Int()
+		}
+		return ints, true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		ints := make([]int64, v.Len())
+		for i := range ints {
+			u := v.Index(i).Uint()
+			if u > math.MaxInt64 {
+				return nil, false, fmt.Errorf("value %v at row %v overflows int64", u, i)
+			}
+			ints[i] = int64(u)
+		}
+		return ints, true, nil
+	case reflect.Float32:
+		floats := make([]float64, v.Len())
+		for i := range floats {
+			floats[i] = v.Index(i).Float()
+		}
+		return floats, true, nil
+	}
+	return nil, false, nil
+}
+
+// eval evaluates node for all rows. In strict mode it does not fall back
+// to row by row evaluation and returns false instead.
+func (e *evaluator) eval(node ast.Node, strict bool) (interface{}, bool) {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		if column, ok := e.columns[n.Value]; ok {
+			return column, true
+		}
+
+	case *ast.IntegerNode:
+		if n.Type() != nil && n.Type().Kind() == reflect.Float64 {
+			return scalar{float64(n.Value)}, true
+		}
+		return scalar{int64(n.Value)}, true
+
+	case *ast.FloatNode:
+		return scalar{n.Value}, true
+
+	case *ast.StringNode:
+		return scalar{n.Value}, true
+
+	case *ast.BoolNode:
+		return scalar{n.Value}, true
+
+	case *ast.UnaryNode:
+		if a, ok := e.eval(n.Node, strict); ok {
+			if out, ok := e.unary(n.Operator, a); ok {
+				return out, true
+			}
+		}
+
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "and", "&&", "or", "||":
+			// Right side is evaluated for all rows, so it must not fail
+			// on rows where it would be skipped by short-circuit.
+			if a, ok := e.eval(n.Left, strict); ok {
+				if b, ok := e.eval(n.Right, true); ok {
+					if out, ok := e.binary(n.Operator, a, b); ok {
+						return out, true
+					}
+				}
+			}
+		default:
+			if a, ok := e.eval(n.Left, strict); ok {
+				if b, ok := e.eval(n.Right, strict); ok {
+					if out, ok := e.binary(n.Operator, a, b); ok {
+						return out, true
+					}
+				}
+			}
+		}
+	}
+
+	if strict {
+		return nil, false
+	}
+	return e.rows(node), true
+}
+
+// rows evaluates node row by row.
+func (e *evaluator) rows(node ast.Node) interface{} {
+	program, err := compiler.Compile(&parser.Tree{Node: node, Source: e.source.Source}, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	env := make(map[string]interface{}, len(e.raw))
+	values := make(map[string]reflect.Value, len(e.raw))
+	for name, column := range e.raw {
+		if _, ok := e.columns[name].(scalar); ok {
+			env[name] = column
+		} else {
+			values[name] = reflect.ValueOf(column)
+		}
+	}
+
+	out := make([]interface{}, e.size)
+	machine := &vm.VM{}
+	machine.Init(program, env)
+	for i := 0; i < e.size; i++ {
+		for name, v := range values {
+			env[name] = v.Index(i).Interface()
+		}
+		out[i], err = machine.Run(program, env)
+		if err != nil {
+			panic(fmt.Errorf("row %v: %v", i, err))
+		}
+	}
+	return typed(out)
+}
+
+// typed converts values to typed column if all values have the same type.
+func typed(values []interface{}) interface{} {
+	if len(values) == 0 {
+		return values
+	}
+	switch values[0].(type) {
+	case int, int64:
+		out := make([]int64, len(values))
+		for i, v := range values {
+			switch x := v.(type) {
+			case int:
+				out[i] = int64(x)
+			case int64:
+				out[i] = x
+			default:
+				return values
+			}
+		}
+		return out
+	case float64:
+		out := make([]float64, len(values))
+		for i, v := range values {
+			x, ok := v.(float64)
+			if !ok {
+				return values
+			}
+			out[i] = x
+		}
+		return out
+	case string:
+		out := make([]string, len(values))
+		for i, v := range values {
+			x, ok := v.(string)
+			if !ok {
+				return values
+			}
+			out[i] = x
+		}
+		return out
+	case bool:
+		out := make([]bool, len(values))
+		for i, v := range values {
+			x, ok := v.(bool)
+			if !ok {
+				return values
+			}
+			out[i] = x
+		}
+		return out
+	}
+	return values
+}
+
+// column broadcasts scalar value to a column.
+func (e *evaluator) column(v interface{}) interface{} {
+	s, ok := v.(scalar)
+	if !ok {
+		return v
+	}
+	switch x := s.value.(type) {
+	case int64:
+		out := make([]int64, e.size)
+		for i := range out {
+			out[i] = x
+		}
+		return out
+	case float64:
+		out := make([]float64, e.size)
+		for i := range out {
+			out[i] = x
+		}
+		return out
+	case string:
+		out := make([]string, e.size)
+		for i := range out {
+			out[i] = x
+		}
+		return out
+	case bool:
+		out := make([]bool, e.size)
+		for i := range out {
+			out[i] = x
+		}
+		return out
+	}
+	out := make([]interface{}, e.size)
+	for i := range out {
+		out[i] = s.value
+	}
+	return out
+}
+
+func (e *evaluator) ints(v interface{}) ([]int64, bool) {
+	switch x := e.column(v).(type) {
+	case []int64:
+		return x, true
+	}
+	return nil, false
+}
+
+func (e *evaluator) floats(v interface{}) ([]float64, bool) {
+	switch x := e.column(v).(type) {
+	case []float64:
+		return x, true
+	case []int64:
+		out := make([]float64, len(x))
+		for i, v := range x {
+			out[i] = float64(v)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func (e *evaluator) strings(v interface{}) ([]string, bool) {
+	x, ok := e.column(v).([]string)
+	return x, ok
+}
+
+func (e *evaluator) bools(v interface{}) ([]bool, bool) {
+	x, ok := e.column(v).([]bool)
+	return x, ok
+}
+
+func (e *evaluator) unary(op string, a interface{}) (interface{}, bool) {
+	switch op {
+	case "+":
+		if x, ok := e.ints(a); ok {
+			return x, true
+		}
+		if x, ok := e.floats(a); ok {
+			return x, true
+		}
+	case "-":
+		if x, ok := e.ints(a); ok {
+			out := make([]int64, len(x))
+			for i := range x {
+				out[i] = -x[i]
+			}
+			return out, true
+		}
+		if x, ok := e.floats(a); ok {
+			out := make([]float64, len(x))
+			for i := range x {
+				out[i] = -x[i]
+			}
+			return out, true
+		}
+	case "!", "not":
+		if x, ok := e.bools(a); ok {
+			out := make([]bool, len(x))
+			for i := range x {
+				out[i] = !x[i]
+			}
+			return out, true
+		}
+	}
+	return nil, false
+}
+
+func (e *evaluator) binary(op string, a, b interface{}) (interface{}, bool) {
+	switch op {
+	case "+", "-", "*", "/", "%":
+		if x, ok := e.ints(a); ok {
+			if y, ok := e.ints(b); ok {
+				return intArithmetic(op, x, y)
+			}
+		}
+		if op == "%" {
+			return nil, false
+		}
+		if x, ok := e.floats(a); ok {
+			if y, ok := e.floats(b); ok {
+				return floatArithmetic(op, x, y), true
+			}
+		}
+		if op == "+" {
+			if x, ok := e.strings(a); ok {
+				if y, ok := e.strings(b); ok {
+					out := make([]string, len(x))
+					for i := range x {
+						out[i] = x[i] + y[i]
+					}
+					return out, true
+				}
+			}
+		}
+
+	case "**":
+		if x, ok := e.floats(a); ok {
+			if y, ok := e.floats(b); ok {
+				out := make([]float64, len(x))
+				for i := range x {
+					out[i] = math.Pow(x[i], y[i])
+				}
+				return out, true
+			}
+		}
+
+	case "==", "!=", "<", ">", "<=", ">=":
+		var out []bool
+		if x, ok := e.ints(a); ok {
+			if y, ok := e.ints(b); ok {
+				out = compareInts(op, x, y)
+			}
+		}
+		if out == nil {
+			if x, ok := e.floats(a); ok {
+				if y, ok := e.floats(b); ok {
+					out = compareFloats(op, x, y)
+				}
+			}
+		}
+		if out == nil {
+			if x, ok := e.strings(a); ok {
+				if y, ok := e.strings(b); ok {
+					out = compareStrings(op, x, y)
+				}
+			}
+		}
+		if out == nil && (op == "==" || op == "!=") {
+			if x, ok := e.bools(a); ok {
+				if y, ok := e.bools(b); ok {
+					out = make([]bool, len(x))
+					for i := range x {
+						out[i] = (x[i] == y[i]) == (op == "==")
+					}
+				}
+			}
+		}
+		if out != nil {
+			return out, true
+		}
+
+	case "and", "&&", "or", "||":
+		if x, ok := e.bools(a); ok {
+			if y, ok := e.bools(b); ok {
+				out := make([]bool, len(x))
+				if op == "and" || op == "&&" {
+					for i := range x {
+						out[i] = x[i] && y[i]
+					}
+				} else {
+					for i := range x {
+						out[i] = x[i] || y[i]
+					}
+				}
+				return out, true
+			}
+		}
+
+	case "contains", "startsWith", "endsWith":
+		if x, ok := e.strings(a); ok {
+			if y, ok := e.strings(b); ok {
+				match := strings.Contains
+				if op == "startsWith" {
+					match = strings.HasPrefix
+				} else if op == "endsWith" {
+					match = strings.HasSuffix
+				}
+				out := make([]bool, len(x))
+				for i := range x {
+					out[i] = match(x[i], y[i])
+				}
+				return out, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func intArithmetic(op string, x, y []int64) (interface{}, bool) {
+	out := make([]int64, len(x))
+	switch op {
+	case "+":
+		for i := range x {
+			out[i] = x[i] + y[i]
+		}
+	case "-":
+		for i := range x {
+			out[i] = x[i] - y[i]
+		}
+	case "*":
+		for i := range x {
+			out[i] = x[i] * y[i]
+		}
+	case "/", "%":
+		for i := range y {
+			if y[i] == 0 {
+				return nil, false // Let vm report division by zero.
+			}
+		}
+		if op == "/" {
+			for i := range x {
+				out[i] = x[i] / y[i]
+			}
+		} else {
+			for i := range x {
+				out[i] = x[i] % y[i]
+			}
+		}
+	}
+	return out, true
+}
+
+func floatArithmetic(op string, x, y []float64) []float64 {
+	out := make([]float64, len(x))
+	switch op {
+	case "+":
+		for i := range x {
+			out[i] = x[i] + y[i]
+		}
+	case "-":
+		for i := range x {
+			out[i] = x[i] - y[i]
+		}
+	case "*":
+		for i := range x {
+			out[i] = x[i] * y[i]
+		}
+	case "/":
+		for i := range x {
+			out[i] = x[i] / y[i]
+		}
+	}
+	return out
+}
+
+func compareInts(op string, x, y []int64) []bool {
+	out := make([]bool, len(x))
+	switch op {
+	case "==":
+		for i := range x {
+			out[i] = x[i] == y[i]
+		}
+	case "!=":
+		for i := range x {
+			out[i] = x[i] != y[i]
+		}
+	case "<":
+		for i := range x {
+			out[i] = x[i] < y[i]
+		}
+	case ">":
+		for i := range x {
+			out[i] = x[i] > y[i]
+		}
+	case "<=":
+		for i := range x {
+			out[i] = x[i] <= y[i]
+		}
+	case ">=":
+		for i := range x {
+			out[i] = x[i] >= y[i]
+		}
+	}
+	return out
+}
+
+func compareFloats(op string, x, y []float64) []bool {
+	out := make([]bool, len(x))
+	switch op {
+	case "==":
+		for i := range x {
+			out[i] = x[i] == y[i]
+		}
+	case "!=":
+		for i := range x {
+			out[i] = x[i] != y[i]
+		}
+	case "<":
+		for i := range x {
+			out[i] = x[i] < y[i]
+		}
+	case ">":
+		for i := range x {
+			out[i] = x[i] > y[i]
+		}
+	case "<=":
+		for i := range x {
+			out[i] = x[i] <= y[i]
+		}
+	case ">=":
+		for i := range x {
+			out[i] = x[i] >= y[i]
+		}
+	}
+	return out
+}
+
+func compareStrings(op string, x, y []string) []bool {
+	out := make([]bool, len(x))
+	switch op {
+	case "==":
+		for i := range x {
+			out[i] = x[i] == y[i]
+		}
+	case "!=":
+		for i := range x {
+			out[i] = x[i] != y[i]
+		}
+	case "<":
+		for i := range x {
+			out[i] = x[i] < y[i]
+		}
+	case ">":
+		for i := range x {
+			out[i] = x[i] > y[i]
+		}
+	case "<=":
+		for i := range x {
+			out[i] = x[i] <= y[i]
+		}
+	case ">=":
+		for i := range x {
+			out[i] = x[i] >= y[i]
+		}
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package columnar_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/byte-power/jsexpr"
+	"github.com/byte-power/jsexpr/columnar"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	columns := map[string]interface{}{
+		"age":     []int64{16, 21, 35, 70},
+		"score":   []float64{0.5, 1.5, 2.5, 3.5},
+		"country": []string{"US", "FR", "US", "DE"},
+		"active":  []bool{true, true, false, true},
+		"limit":   30,
+		"upper":   strings.ToUpper,
+	}
+
+	tests := []struct {
+		input  string
+		output interface{}
+	}{
+		{`age + 1`, []int64{17, 22, 36, 71}},
+		{`age * score`, []float64{8, 31.5, 87.5, 245}},
+		{`age / 2 - limit`, []int64{-22, -20, -13, 5}},
+		{`-score`, []float64{-0.5, -1.5, -2.5, -3.5}},
+		{`country + "!"`, []string{"US!", "FR!", "US!", "DE!"}},
+		{`upper(country) + "?"`, []string{"US?", "FR?", "US?", "DE?"}},
+		{`len(country) * age`, []int64{32, 42, 70, 140}},
+		{`active ? age : 0`, []int64{16, 21, 0, 70}},
+	}
+
+	for _, test := range tests {
+		program, err := jsexpr.Compile(test.input, jsexpr.AllowUndefinedVariables())
+		require.NoError(t, err, test.input)
+
+		out, err := columnar.Run(program, columns)
+		require.NoError(t, err, test.input)
+		require.Equal(t, test.output, out, test.input)
+	}
+}
+
+func TestRun_selection(t *testing.T) {
+	columns := map[string]interface{}{
+		"age":     []int{16, 21, 35, 70, 0},
+		"country": []string{"US", "FR", "US", "DE", "US"},
+		"tags":    []interface{}{nil, []string{"a"}, []string{"b", "c"}, []string{}, nil},
+	}
+
+	tests := []struct {
+		input string
+		rows  []int
+	}{
+		{`age >= 18 and country == "US"`, []int{2}},
+		{`age < 18 || country != "US"`, []int{0, 1, 3, 4}},
+		{`not (country startsWith "U")`, []int{1, 3}},
+		{`age > 0 and 100 / age > 2`, []int{0, 1}},
+		{`age > 18 and len(tags) > 1`, []int{2}},
+		{`false`, []int{}},
+	}
+
+	for _, test := range tests {
+		program, err := jsexpr.Compile(test.input, jsexpr.AllowUndefinedVariables())
+		require.NoError(t, err, test.input)
+
+		out, err := columnar.Run(program, columns)
+		require.NoError(t, err, test.input)
+		require.IsType(t, &columnar.Bitmap{}, out, test.input)
+
+		bitmap := out.(*columnar.Bitmap)
+		require.Equal(t, 5, bitmap.Len(), test.input)
+		require.Equal(t, test.rows, bitmap.Rows(), test.input)
+		require.Equal(t, len(test.rows), bitmap.Count(), test.input)
+	}
+}
+
+func TestRun_narrow(t *testing.T) {
+	columns := map[string]interface{}{
+		"small": []int32{1, 2, 3, 4},
+		"count": []uint16{4, 3, 2, 1},
+		"ratio": []float32{0.5, 1.5, 2.5, 3.5},
+	}
+
+	tests := []struct {
+		input  string
+		output interface{}
+	}{
+		{`small * 2`, []int64{2, 4, 6, 8}},
+		{`small + count`, []int64{5, 5, 5, 5}},
+		{`ratio * 2`, []float64{1, 3, 5, 7}},
+	}
+
+	for _, test := range tests {
+		program, err := jsexpr.Compile(test.input, jsexpr.AllowUndefinedVariables())
+		require.NoError(t, err, test.input)
+
+		out, err := columnar.Run(program, columns)
+		require.NoError(t, err, test.input)
+		require.Equal(t, test.output, out, test.input)
+	}
+}
+
+func TestRun_errors(t *testing.T) {
+	program, err := jsexpr.Compile(`100 / age`, jsexpr.AllowUndefinedVariables())
+	require.NoError(t, err)
+
+	_, err = columnar.Run(program, map[string]interface{}{"age": []int{1, 0}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "row 1: runtime error: integer divide by zero")
+
+	_, err = columnar.Run(program, map[string]interface{}{"age": []int{1, 0}, "x": []string{"a"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "rows, expected")
+
+	_, err = columnar.Run(program, map[string]interface{}{"age": []uint64{1, math.MaxUint64}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "column age: value 18446744073709551615 at row 1 overflows int64")
+}
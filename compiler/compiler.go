@@ -14,30 +14,57 @@ import (
 	. "github.com/byte-power/jsexpr/vm"
 )
 
-func Compile(tree *parser.Tree, config *conf.Config) (program *Program, err error) {
+// errNarrow is raised when operand does not fit into narrow encoding.
+var errNarrow = fmt.Errorf("operand does not fit into %v bytes", narrow)
+
+const (
+	narrow = 2 // Size of operands in bytes.
+	wide   = 4 // Size of operands of wide programs.
+)
+
+func Compile(tree *parser.Tree, config *conf.Config) (*Program, error) {
+	program, err := compile(tree, config, false)
+	if err == errNarrow {
+		// Program is too large for 2 byte operands.
+		return compile(tree, config, true)
+	}
+	return program, err
+}
+
+func compile(tree *parser.Tree, config *conf.Config, wide bool) (program *Program, err error) {
 	defer func() {
 		if r := recover(); r != nil {
+			if r == errNarrow {
+				err = errNarrow
+				return
+			}
 			err = fmt.Errorf("%v", r)
 		}
 	}()
 
 	c := &compiler{
-		index:     make(map[interface{}]uint16),
+		wide:      wide,
+		index:     make(map[interface{}]int),
 		locations: make(map[int]file.Location),
+		branches:  make(map[int]Branch),
+		parent:    -1,
 	}
 
 	if config != nil {
 		c.mapEnv = config.MapEnv
 		c.cast = config.Expect
+		if !c.mapEnv && config.Env != nil {
+			c.envType = dereference(reflect.TypeOf(config.Env))
+		}
 	}
 
 	c.compile(tree.Node)
 
 	switch c.cast {
 	case reflect.Int64:
-		c.emit(OpCast, encode(0)...)
+		c.emit(OpCast, c.operand(0)...)
 	case reflect.Float64:
-		c.emit(OpCast, encode(1)...)
+		c.emit(OpCast, c.operand(1)...)
 	}
 
 	program = &Program{
@@ -45,6 +72,15 @@ func Compile(tree *parser.Tree, config *conf.Config) (program *Program, err erro
 		Locations: c.locations,
 		Constants: c.constants,
 		Bytecode:  c.bytecode,
+		Spans:     c.spans,
+		Branches:  c.branches,
+		Wide:      c.wide,
+	}
+	if config != nil {
+		program.Clock = config.Clock
+		program.Rand = config.Rand
+		program.CallStack = config.CallStack
+		program.CallArgLimit = config.CallArgLimit
 	}
 	return
 }
@@ -53,10 +89,15 @@ type compiler struct {
 	locations map[int]file.Location
 	constants []interface{}
 	bytecode  []byte
-	index     map[interface{}]uint16
+	index     map[interface{}]int
+	wide      bool
 	mapEnv    bool
+	envType   reflect.Type
 	cast      reflect.Kind
 	nodes     []ast.Node
+	spans     []Span
+	branches  map[int]Branch
+	parent    int
 }
 
 func (c *compiler) emit(op byte, b ...byte) int {
@@ -78,48 +119,63 @@ func (c *compiler) emitPush(value interface{}) int {
 }
 
 func (c *compiler) makeConstant(i interface{}) []byte {
-	hashable := true
-	switch reflect.TypeOf(i).Kind() {
-	case reflect.Slice, reflect.Map:
-		hashable = false
-	}
+	hashable := reflect.TypeOf(i).Comparable()
 
 	if hashable {
 		if p, ok := c.index[i]; ok {
-			return encode(p)
+			return c.operand(p)
 		}
 	}
 
 	c.constants = append(c.constants, i)
-	if len(c.constants) > math.MaxUint16 {
-		panic("exceeded constants max space limit")
-	}
-
-	p := uint16(len(c.constants) - 1)
+	p := len(c.constants) - 1
 	if hashable {
 		c.index[i] = p
 	}
-	return encode(p)
+	return c.operand(p)
+}
+
+// branch marks conditional jump which starts at pos-1 as testing value of span cond.
+func (c *compiler) branch(pos int, cond int, negate bool) {
+	c.branches[pos-1] = Branch{Cond: cond, Negate: negate}
+}
+
+func (c *compiler) size() int {
+	if c.wide {
+		return wide
+	}
+	return narrow
 }
 
 func (c *compiler) placeholder() []byte {
-	return []byte{0xFF, 0xFF}
+	b := make([]byte, c.size())
+	for i := range b {
+		b[i] = 0xFF
+	}
+	return b
 }
 
 func (c *compiler) patchJump(placeholder int) {
-	offset := len(c.bytecode) - 2 - placeholder
-	b := encode(uint16(offset))
-	c.bytecode[placeholder] = b[0]
-	c.bytecode[placeholder+1] = b[1]
+	offset := len(c.bytecode) - c.size() - placeholder
+	copy(c.bytecode[placeholder:], c.operand(offset))
 }
 
 func (c *compiler) calcBackwardJump(to int) []byte {
-	return encode(uint16(len(c.bytecode) + 1 + 2 - to))
+	return c.operand(len(c.bytecode) + 1 + c.size() - to)
 }
 
 func (c *compiler) compile(node ast.Node) {
 	c.nodes = append(c.nodes, node)
+
+	// Remember which bytecode computes which node, the node value
+	// is on top of the stack when vm reaches the end of the span.
+	span, parent := len(c.spans), c.parent
+	c.spans = append(c.spans, Span{Node: node, Parent: parent, Start: len(c.bytecode)})
+	c.parent = span
+
 	defer func() {
+		c.spans[span].End = len(c.bytecode)
+		c.parent = parent
 		c.nodes = c.nodes[:len(c.nodes)-1]
 	}()
 
@@ -178,6 +234,11 @@ func (c *compiler) NilNode(node *ast.NilNode) {
 }
 
 func (c *compiler) IdentifierNode(node *ast.IdentifierNode) {
+	if field, _, ok := c.field(node); ok {
+		c.emit(OpFetchField, c.makeConstant(field)...)
+		return
+	}
+
 	v := c.makeConstant(node.Value)
 	if c.mapEnv {
 		c.emit(OpFetchMap, v...)
@@ -266,21 +327,21 @@ func (c *compiler) UnaryNode(node *ast.UnaryNode) {
 }
 
 func (c *compiler) BinaryNode(node *ast.BinaryNode) {
-	l := kind(node.Left)
-	r := kind(node.Right)
+	if op, ok := typedOps[node.Operator][typed(node)]; ok {
+		c.compile(node.Left)
+		c.compile(node.Right)
+		c.emit(op)
+		if node.Operator == "!=" {
+			c.emit(OpNot)
+		}
+		return
+	}
 
 	switch node.Operator {
 	case "==":
 		c.compile(node.Left)
 		c.compile(node.Right)
-
-		if l == r && l == reflect.Int {
-			c.emit(OpEqualInt)
-		} else if l == r && l == reflect.String {
-			c.emit(OpEqualString)
-		} else {
-			c.emit(OpEqual)
-		}
+		c.emit(OpEqual)
 
 	case "!=":
 		c.compile(node.Left)
@@ -289,15 +350,19 @@ func (c *compiler) BinaryNode(node *ast.BinaryNode) {
 		c.emit(OpNot)
 
 	case "or", "||":
+		cond := len(c.spans)
 		c.compile(node.Left)
 		end := c.emit(OpJumpIfTrue, c.placeholder()...)
+		c.branch(end, cond, false)
 		c.emit(OpPop)
 		c.compile(node.Right)
 		c.patchJump(end)
 
 	case "and", "&&":
+		cond := len(c.spans)
 		c.compile(node.Left)
 		end := c.emit(OpJumpIfFalse, c.placeholder()...)
+		c.branch(end, cond, false)
 		c.emit(OpPop)
 		c.compile(node.Right)
 		c.patchJump(end)
@@ -401,10 +466,62 @@ func (c *compiler) MatchesNode(node *ast.MatchesNode) {
 }
 
 func (c *compiler) PropertyNode(node *ast.PropertyNode) {
+	if field, _, ok := c.field(node); ok {
+		// Whole chain of properties is fetched at once,
+		// so nodes of the chain have empty spans.
+		c.chain(node.Node)
+		c.emit(OpFetchField, c.makeConstant(field)...)
+		return
+	}
+
 	c.compile(node.Node)
 	c.emit(OpProperty, c.makeConstant(node.Property)...)
 }
 
+// chain records empty spans of node and nodes it is made of,
+// which are parts of chain of properties fetched at once.
+func (c *compiler) chain(node ast.Node) {
+	span, parent := len(c.spans), c.parent
+	c.spans = append(c.spans, Span{Node: node, Parent: parent, Start: len(c.bytecode), End: len(c.bytecode)})
+	if n, ok := node.(*ast.PropertyNode); ok {
+		c.parent = span
+		c.chain(n.Node)
+		c.parent = parent
+	}
+}
+
+// field resolves chain of properties starting at env variable to index
+// path of struct fields. It returns the chain and type of its last field.
+func (c *compiler) field(node ast.Node) (Field, reflect.Type, bool) {
+	var field Field
+	var t reflect.Type
+	var name string
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		if c.envType == nil {
+			return Field{}, nil, false
+		}
+		field, t, name = Field{Type: c.envType}, c.envType, n.Value
+	case *ast.PropertyNode:
+		var ok bool
+		if field, t, ok = c.field(n.Node); !ok {
+			return Field{}, nil, false
+		}
+		name = n.Property
+	default:
+		return Field{}, nil, false
+	}
+
+	t = dereference(t)
+	index, ok := FieldIndex(t, name)
+	if !ok {
+		return Field{}, nil, false
+	}
+	field.Names = append(field.Names[:len(field.Names):len(field.Names)], name)
+	field.Path = append(field.Path[:len(field.Path):len(field.Path)], index...)
+	return field, t.FieldByIndex(index).Type, true
+}
+
 func (c *compiler) IndexNode(node *ast.IndexNode) {
 	c.compile(node.Node)
 	c.compile(node.Index)
@@ -458,8 +575,10 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 		c.emit(OpBegin)
 		var loopBreak int
 		c.emitLoop(func() {
+			cond := len(c.spans)
 			c.compile(node.Arguments[1])
 			loopBreak = c.emit(OpJumpIfFalse, c.placeholder()...)
+			c.branch(loopBreak, cond, false)
 			c.emit(OpPop)
 		})
 		c.emit(OpTrue)
@@ -471,9 +590,11 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 		c.emit(OpBegin)
 		var loopBreak int
 		c.emitLoop(func() {
+			cond := len(c.spans)
 			c.compile(node.Arguments[1])
 			c.emit(OpNot)
 			loopBreak = c.emit(OpJumpIfFalse, c.placeholder()...)
+			c.branch(loopBreak, cond, true)
 			c.emit(OpPop)
 		})
 		c.emit(OpTrue)
@@ -485,8 +606,10 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 		c.emit(OpBegin)
 		var loopBreak int
 		c.emitLoop(func() {
+			cond := len(c.spans)
 			c.compile(node.Arguments[1])
 			loopBreak = c.emit(OpJumpIfTrue, c.placeholder()...)
+			c.branch(loopBreak, cond, false)
 			c.emit(OpPop)
 		})
 		c.emit(OpFalse)
@@ -500,8 +623,9 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 		c.emitPush(0)
 		c.emit(OpStore, count...)
 		c.emitLoop(func() {
+			cond := len(c.spans)
 			c.compile(node.Arguments[1])
-			c.emitCond(func() {
+			c.emitCond(cond, func() {
 				c.emit(OpInc, count...)
 			})
 		})
@@ -517,8 +641,9 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 		c.emitPush(0)
 		c.emit(OpStore, count...)
 		c.emitLoop(func() {
+			cond := len(c.spans)
 			c.compile(node.Arguments[1])
-			c.emitCond(func() {
+			c.emitCond(cond, func() {
 				c.emit(OpInc, count...)
 
 				c.emit(OpLoad, c.makeConstant("array")...)
@@ -547,8 +672,9 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 		c.emitPush(0)
 		c.emit(OpStore, count...)
 		c.emitLoop(func() {
+			cond := len(c.spans)
 			c.compile(node.Arguments[1])
-			c.emitCond(func() {
+			c.emitCond(cond, func() {
 				c.emit(OpInc, count...)
 			})
 		})
@@ -566,8 +692,9 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	}
 }
 
-func (c *compiler) emitCond(body func()) {
+func (c *compiler) emitCond(cond int, body func()) {
 	noop := c.emit(OpJumpIfFalse, c.placeholder()...)
+	c.branch(noop, cond, false)
 	c.emit(OpPop)
 
 	body()
@@ -618,8 +745,10 @@ func (c *compiler) PointerNode(node *ast.PointerNode) {
 }
 
 func (c *compiler) ConditionalNode(node *ast.ConditionalNode) {
+	cond := len(c.spans)
 	c.compile(node.Cond)
 	otherwise := c.emit(OpJumpIfFalse, c.placeholder()...)
+	c.branch(otherwise, cond, false)
 
 	c.emit(OpPop)
 	c.compile(node.Exp1)
@@ -655,16 +784,66 @@ func (c *compiler) PairNode(node *ast.PairNode) {
 	c.compile(node.Value)
 }
 
-func encode(i uint16) []byte {
-	b := make([]byte, 2)
-	binary.LittleEndian.PutUint16(b, i)
+// operand encodes constant index or jump offset. Narrow programs are
+// recompiled as wide once an operand does not fit into 2 bytes.
+func (c *compiler) operand(i int) []byte {
+	if !c.wide {
+		if i > math.MaxUint16 {
+			panic(errNarrow)
+		}
+		b := make([]byte, narrow)
+		binary.LittleEndian.PutUint16(b, uint16(i))
+		return b
+	}
+	if int64(i) > math.MaxUint32 {
+		panic(fmt.Sprintf("operand %v exceeds limit of %v, expression is too large", i, uint32(math.MaxUint32)))
+	}
+	b := make([]byte, wide)
+	binary.LittleEndian.PutUint32(b, uint32(i))
 	return b
 }
 
-func kind(node ast.Node) reflect.Kind {
-	t := node.Type()
-	if t == nil {
+var (
+	intType    = reflect.TypeOf(0)
+	floatType  = reflect.TypeOf(float64(0))
+	stringType = reflect.TypeOf("")
+)
+
+// typedOps are opcodes of binary operators specialized for operands
+// of the same statically known type. They skip type switches of generic opcodes.
+var typedOps = map[string]map[reflect.Kind]byte{
+	"==": {reflect.Int: OpEqualInt, reflect.Float64: OpEqualFloat, reflect.String: OpEqualString},
+	"!=": {reflect.Int: OpEqualInt, reflect.Float64: OpEqualFloat, reflect.String: OpEqualString},
+	"<":  {reflect.Int: OpLessInt, reflect.Float64: OpLessFloat, reflect.String: OpLessString},
+	">":  {reflect.Int: OpMoreInt, reflect.Float64: OpMoreFloat, reflect.String: OpMoreString},
+	"<=": {reflect.Int: OpLessOrEqualInt, reflect.Float64: OpLessOrEqualFloat, reflect.String: OpLessOrEqualString},
+	">=": {reflect.Int: OpMoreOrEqualInt, reflect.Float64: OpMoreOrEqualFloat, reflect.String: OpMoreOrEqualString},
+	"+":  {reflect.Int: OpAddInt, reflect.Float64: OpAddFloat, reflect.String: OpConcatString},
+	"-":  {reflect.Int: OpSubtractInt, reflect.Float64: OpSubtractFloat},
+	"*":  {reflect.Int: OpMultiplyInt, reflect.Float64: OpMultiplyFloat},
+	"/":  {reflect.Int: OpDivideInt, reflect.Float64: OpDivideFloat},
+	"%":  {reflect.Int: OpModuloInt},
+}
+
+// dereference returns type pointed to by t through any number of pointers.
+func dereference(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// typed returns kind of operands of binary node if both of them are
+// exactly int, float64 or string, otherwise it returns reflect.Invalid.
+// Named types are excluded as typed opcodes assert values to these types.
+func typed(node *ast.BinaryNode) reflect.Kind {
+	l := node.Left.Type()
+	if l == nil || l != node.Right.Type() {
 		return reflect.Invalid
 	}
-	return t.Kind()
+	switch l {
+	case intType, floatType, stringType:
+		return l.Kind()
+	}
+	return reflect.Invalid
 }
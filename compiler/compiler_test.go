@@ -1,10 +1,13 @@
 package compiler_test
 
 import (
+	"fmt"
 	"math"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/byte-power/jsexpr/checker"
 	"github.com/byte-power/jsexpr/compiler"
 	"github.com/byte-power/jsexpr/conf"
 	"github.com/byte-power/jsexpr/parser"
@@ -168,3 +171,94 @@ func TestCompile_cast(t *testing.T) {
 
 	assert.Equal(t, expected.Disassemble(), program.Disassemble())
 }
+
+func TestCompile_wide(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(`x == "v0"`)
+	for i := 1; i < 70000; i++ {
+		fmt.Fprintf(&b, ` or x == "v%v"`, i)
+	}
+	tree, err := parser.Parse(b.String())
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+	require.True(t, program.Wide)
+	require.Greater(t, len(program.Constants), math.MaxUint16)
+
+	for _, x := range []string{"v0", "v65536", "v69999", "none"} {
+		out, err := vm.Run(program, map[string]interface{}{"x": x})
+		require.NoError(t, err)
+		require.Equal(t, x != "none", out, x)
+	}
+}
+
+func TestCompile_narrow(t *testing.T) {
+	tree, err := parser.Parse(`all(1..3, {# > 0}) ? "yes" : "no"`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+	require.False(t, program.Wide)
+
+	out, err := vm.Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, "yes", out)
+}
+
+func TestCompile_typed(t *testing.T) {
+	type Age int
+	type Env struct {
+		I   int
+		F   float64
+		S   string
+		Age Age
+		Any interface{}
+	}
+	env := Env{I: 7, F: 2.5, S: "ab", Age: 30, Any: 1}
+
+	tests := []struct {
+		input  string
+		op     byte
+		output interface{}
+	}{
+		{`I + 1`, vm.OpAddInt, 8},
+		{`I - 10`, vm.OpSubtractInt, -3},
+		{`I * I`, vm.OpMultiplyInt, 49},
+		{`I / 2`, vm.OpDivideInt, 3},
+		{`I % 4`, vm.OpModuloInt, 3},
+		{`I == 7`, vm.OpEqualInt, true},
+		{`I != 7`, vm.OpEqualInt, false},
+		{`I < 7`, vm.OpLessInt, false},
+		{`I >= 7`, vm.OpMoreOrEqualInt, true},
+		{`F + 1.5`, vm.OpAddFloat, 4.0},
+		{`F - F`, vm.OpSubtractFloat, 0.0},
+		{`F * 2.0`, vm.OpMultiplyFloat, 5.0},
+		{`F / 0.5`, vm.OpDivideFloat, 5.0},
+		{`F > 2.0`, vm.OpMoreFloat, true},
+		{`F <= 2.5`, vm.OpLessOrEqualFloat, true},
+		{`F == 2.5`, vm.OpEqualFloat, true},
+		{`S + "c"`, vm.OpConcatString, "abc"},
+		{`S < "b"`, vm.OpLessString, true},
+		{`S == "ab"`, vm.OpEqualString, true},
+		{`I + F`, vm.OpAdd, 9.5},
+		{`Age == Age`, vm.OpEqual, true},
+		{`Any + 1`, vm.OpAdd, 2},
+	}
+
+	for _, test := range tests {
+		tree, err := parser.Parse(test.input)
+		require.NoError(t, err, test.input)
+
+		_, err = checker.Check(tree, conf.New(env))
+		require.NoError(t, err, test.input)
+
+		program, err := compiler.Compile(tree, nil)
+		require.NoError(t, err, test.input)
+		require.Contains(t, program.Disassemble(), vm.OpcodeName(test.op), test.input)
+
+		out, err := vm.Run(program, env)
+		require.NoError(t, err, test.input)
+		require.Equal(t, test.output, out, test.input)
+	}
+}
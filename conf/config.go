@@ -2,9 +2,11 @@ package conf
 
 import (
 	"fmt"
+	"math/rand"
 	"reflect"
 
 	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/builtin"
 	"github.com/byte-power/jsexpr/vm"
 )
 
@@ -19,6 +21,11 @@ type Config struct {
 	DefaultType  reflect.Type
 	ConstExprFns map[string]reflect.Value
 	Visitors     []ast.Visitor
+	Known        map[string]interface{}
+	Clock        builtin.Clock
+	Rand         rand.Source
+	CallStack    bool
+	CallArgLimit int
 	err          error
 }
 
@@ -0,0 +1,264 @@
+package jsexpr
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/builtin"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/byte-power/jsexpr/vm"
+)
+
+// Deps lists data and functions an expression uses. All lists are sorted.
+type Deps struct {
+	// Variables are root identifiers fetched from env.
+	Variables []string
+	// Paths are fully qualified property paths, like "user.address.city".
+	// Elements of arrays iterated by closures are denoted as "orders[*]",
+	// indexes which are not constant are denoted the same way. Elements
+	// are followed through filter and map, so # of map(filter(orders, ...), ...)
+	// is "orders[*]" too.
+	Paths []string
+	// Functions are functions called from env.
+	Functions []string
+	// Methods are methods called with path of receiver, like "user.fullName".
+	Methods []string
+	// Builtins are builtin objects (Math, Date) and functions (parseInt) used.
+	Builtins []string
+}
+
+// Dependencies returns dependencies of compiled program.
+func Dependencies(program *vm.Program) (*Deps, error) {
+	if program == nil {
+		return nil, fmt.Errorf("program is nil")
+	}
+	if len(program.Spans) == 0 {
+		return nil, fmt.Errorf("program has no node spans, it should be compiled from source")
+	}
+	return NodeDependencies(program.Spans[0].Node), nil
+}
+
+// TreeDependencies returns dependencies of parsed tree.
+func TreeDependencies(tree *parser.Tree) *Deps {
+	return NodeDependencies(tree.Node)
+}
+
+// NodeDependencies returns dependencies of AST node.
+func NodeDependencies(node ast.Node) *Deps {
+	d := &depsVisitor{
+		variables: make(map[string]struct{}),
+		paths:     make(map[string]struct{}),
+		functions: make(map[string]struct{}),
+		methods:   make(map[string]struct{}),
+		builtins:  make(map[string]struct{}),
+	}
+	d.visit(node)
+	return &Deps{
+		Variables: sorted(d.variables),
+		Paths:     sorted(d.paths),
+		Functions: sorted(d.functions),
+		Methods:   sorted(d.methods),
+		Builtins:  sorted(d.builtins),
+	}
+}
+
+type closure struct {
+	path string
+	ok   bool
+}
+
+type depsVisitor struct {
+	variables map[string]struct{}
+	paths     map[string]struct{}
+	functions map[string]struct{}
+	methods   map[string]struct{}
+	builtins  map[string]struct{}
+	closures  []closure
+}
+
+func (d *depsVisitor) visit(node ast.Node) {
+	switch n := node.(type) {
+	case nil:
+
+	case *ast.IdentifierNode, *ast.PropertyNode, *ast.IndexNode, *ast.PointerNode:
+		d.addPath(node)
+
+	case *ast.UnaryNode:
+		d.visit(n.Node)
+
+	case *ast.BinaryNode:
+		d.visit(n.Left)
+		d.visit(n.Right)
+
+	case *ast.MatchesNode:
+		d.visit(n.Left)
+		d.visit(n.Right)
+
+	case *ast.SliceNode:
+		d.addPath(n.Node)
+		d.visit(n.From)
+		d.visit(n.To)
+
+	case *ast.MethodNode:
+		receiver, _ := d.addPath(n.Node)
+		if receiver != "" {
+			d.methods[receiver+"."+n.Method] = struct{}{}
+		} else {
+			d.methods[n.Method] = struct{}{}
+		}
+		for _, arg := range n.Arguments {
+			d.visit(arg)
+		}
+
+	case *ast.FunctionNode:
+		d.functions[n.Name] = struct{}{}
+		for _, arg := range n.Arguments {
+			d.visit(arg)
+		}
+
+	case *ast.BuiltinNode:
+		if _, ok := builtin.Funcs()[n.Name]; ok {
+			d.builtins[n.Name] = struct{}{}
+		}
+		if iterates(n) {
+			d.iterate(n)
+			return
+		}
+		for _, arg := range n.Arguments {
+			d.visit(arg)
+		}
+
+	case *ast.ClosureNode:
+		d.visit(n.Node)
+
+	case *ast.ConditionalNode:
+		d.visit(n.Cond)
+		d.visit(n.Exp1)
+		d.visit(n.Exp2)
+
+	case *ast.ArrayNode:
+		for _, node := range n.Nodes {
+			d.visit(node)
+		}
+
+	case *ast.MapNode:
+		for _, pair := range n.Pairs {
+			d.visit(pair)
+		}
+
+	case *ast.PairNode:
+		d.visit(n.Key)
+		d.visit(n.Value)
+
+	case *ast.ErrorNode:
+		d.visit(n.Node)
+	}
+}
+
+// iterate visits builtin with closure and returns path of elements
+// of its result: elements of filter are ones of its collection, elements
+// of map are results of closure. Path is empty if it is unknown.
+func (d *depsVisitor) iterate(n *ast.BuiltinNode) (string, bool) {
+	path, ok := d.elements(n.Arguments[0])
+	d.closures = append(d.closures, closure{path: path, ok: ok})
+	defer func() { d.closures = d.closures[:len(d.closures)-1] }()
+
+	switch n.Name {
+	case "filter":
+		d.visit(n.Arguments[1])
+		return path, ok
+	case "map":
+		return d.addPath(n.Arguments[1].(*ast.ClosureNode).Node)
+	}
+	d.visit(n.Arguments[1])
+	return "", false
+}
+
+// elements returns path of elements of collection node, following
+// it through filter and map.
+func (d *depsVisitor) elements(node ast.Node) (string, bool) {
+	if n, ok := node.(*ast.BuiltinNode); ok && iterates(n) {
+		return d.iterate(n)
+	}
+	path, ok := d.addPath(node)
+	if path == "" {
+		return "", false
+	}
+	return path + "[*]", ok
+}
+
+func iterates(n *ast.BuiltinNode) bool {
+	if len(n.Arguments) != 2 {
+		return false
+	}
+	_, ok := n.Arguments[1].(*ast.ClosureNode)
+	return ok
+}
+
+// addPath records path of node if node is a chain of property
+// accesses starting from env. It returns path and true in that case.
+func (d *depsVisitor) addPath(node ast.Node) (string, bool) {
+	path, ok := d.path(node)
+	if ok {
+		d.paths[path] = struct{}{}
+	}
+	return path, ok
+}
+
+// path returns path of node and reports whether it points into env.
+// Parts of node which are not paths are visited as regular expressions.
+func (d *depsVisitor) path(node ast.Node) (string, bool) {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		if _, ok := builtin.Objs()[n.Value]; ok {
+			d.builtins[n.Value] = struct{}{}
+			return n.Value, false
+		}
+		d.variables[n.Value] = struct{}{}
+		return n.Value, true
+
+	case *ast.PropertyNode:
+		path, ok := d.path(n.Node)
+		if path == "" {
+			return "", false
+		}
+		return path + "." + n.Property, ok
+
+	case *ast.IndexNode:
+		path, ok := d.path(n.Node)
+		if path == "" {
+			d.visit(n.Index)
+			return "", false
+		}
+		switch i := n.Index.(type) {
+		case *ast.StringNode:
+			return path + "." + i.Value, ok
+		case *ast.IntegerNode:
+			return fmt.Sprintf("%v[%v]", path, i.Value), ok
+		default:
+			d.visit(n.Index)
+			return path + "[*]", ok
+		}
+
+	case *ast.PointerNode:
+		if len(d.closures) == 0 {
+			return "", false
+		}
+		c := d.closures[len(d.closures)-1]
+		return c.path, c.ok
+
+	default:
+		d.visit(node)
+		return "", false
+	}
+}
+
+func sorted(set map[string]struct{}) []string {
+	out := make([]string, 0, len(set))
+	for s := range set {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
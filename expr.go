@@ -2,12 +2,16 @@ package jsexpr
 
 import (
 	"fmt"
+	"math/rand"
 	"reflect"
+	"sort"
 
 	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/builtin"
 	"github.com/byte-power/jsexpr/file"
 
 	"github.com/byte-power/jsexpr/checker"
+	"github.com/byte-power/jsexpr/columnar"
 	"github.com/byte-power/jsexpr/compiler"
 	"github.com/byte-power/jsexpr/conf"
 	"github.com/byte-power/jsexpr/optimizer"
@@ -122,8 +126,112 @@ func Patch(visitor ast.Visitor) Option {
 	}
 }
 
+// Known specifies values of variables known at compile time. Expression is
+// partially evaluated against them: known variables are replaced with values
+// and parts of expression which depend only on them are folded away.
+// Program will evaluate only the residual expression.
+func Known(vars map[string]interface{}) Option {
+	return func(c *conf.Config) {
+		if c.Known == nil {
+			c.Known = make(map[string]interface{})
+		}
+		for name, value := range vars {
+			c.Known[name] = value
+		}
+	}
+}
+
+// Clock makes Date.now of program read given clock instead of time.Now.
+func Clock(clock builtin.Clock) Option {
+	return func(c *conf.Config) {
+		c.Clock = clock
+	}
+}
+
+// RandSource makes Math.random of program draw from given source instead of
+// the global one. Seeded source makes results reproducible. Source is shared
+// by all runs of program, so it is wrapped to be safe for concurrent use.
+func RandSource(source rand.Source) Option {
+	return func(c *conf.Config) {
+		c.Rand = nil
+		if source != nil {
+			c.Rand = builtin.SyncSource(source)
+		}
+	}
+}
+
+// CallStack makes errors of functions and methods panicked in program carry
+// Go stack trace of the panic. Stack capturing is slow, so it is meant to be
+// turned on only for debugging.
+func CallStack() Option {
+	return func(c *conf.Config) {
+		c.CallStack = true
+	}
+}
+
+// CallArgLimit sets max length of argument representation in errors of
+// functions and methods panicked in program, negative limit disables
+// truncation.
+func CallArgLimit(limit int) Option {
+	return func(c *conf.Config) {
+		c.CallArgLimit = limit
+	}
+}
+
 // Compile parses and compiles given input expression to bytecode program.
 func Compile(input string, ops ...Option) (*vm.Program, error) {
+	config, err := newConfig(ops)
+	if err != nil {
+		return nil, err
+	}
+	return compileSource(input, config)
+}
+
+// CompileAST compiles given expression tree, like one decoded with
+// ast.UnmarshalJSON, to bytecode program. Tree is type checked the same
+// way as parsed expression.
+func CompileAST(node ast.Node, ops ...Option) (*vm.Program, error) {
+	if node == nil {
+		return nil, fmt.Errorf("node is nil")
+	}
+	config, err := newConfig(ops)
+	if err != nil {
+		return nil, err
+	}
+	return compileTree(&parser.Tree{Node: node, Source: file.NewSource("")}, config)
+}
+
+// Analyze parses and type checks input expression like Compile, but instead
+// of the first error returns all found problems as diagnostics, ordered by
+// location. Analysis stops at the first syntax error.
+func Analyze(input string, ops ...Option) file.Diagnostics {
+	config, err := newConfig(ops)
+	if err != nil {
+		return file.Diagnostics{{
+			Severity: file.SeverityError,
+			Code:     "config",
+			Message:  err.Error(),
+		}}
+	}
+
+	tree, diagnostics := parser.Analyze(input)
+	if tree == nil {
+		return diagnostics
+	}
+
+	// Patches may fix errors, so only patched tree is analyzed.
+	// Tree which can't be patched is analyzed as is.
+	_ = prepare(tree, config)
+
+	_, diagnostics = checker.Analyze(tree, config)
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Range.Start, diagnostics[j].Range.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return diagnostics
+}
+
+func newConfig(ops []Option) (*conf.Config, error) {
 	config := &conf.Config{
 		Operators:    make(map[string][]string),
 		ConstExprFns: make(map[string]reflect.Value),
@@ -137,31 +245,43 @@ func Compile(input string, ops ...Option) (*vm.Program, error) {
 	if err := config.Check(); err != nil {
 		return nil, err
 	}
+	return config, nil
+}
 
-	tree, err := parser.Parse(input)
-	if err != nil {
-		return nil, err
+// prepare substitutes known variables, patches operators and applies
+// visitors to tree, the steps shared by compiling and analyzing. Tree is
+// type checked first, as patching needs types. Tree should be checked
+// again after prepare.
+func prepare(tree *parser.Tree, config *conf.Config) error {
+	if len(config.Known) > 0 {
+		optimizer.Partial(&tree.Node, config.Known)
 	}
 
-	_, err = checker.Check(tree, config)
+	_, err := checker.Check(tree, config)
 
 	// If we have a patch to apply, it may fix out error and
 	// second type check is needed. Otherwise it is an error.
 	if err != nil && len(config.Visitors) == 0 {
-		return nil, err
+		return err
 	}
 
 	// Patch operators before Optimize, as we may also mark it as ConstExpr.
 	compiler.PatchOperators(&tree.Node, config)
 
-	if len(config.Visitors) >= 0 {
-		for _, v := range config.Visitors {
-			ast.Walk(&tree.Node, v)
-		}
-		_, err = checker.Check(tree, config)
-		if err != nil {
-			return nil, err
-		}
+	for _, v := range config.Visitors {
+		ast.Walk(&tree.Node, v)
+	}
+	return nil
+}
+
+func compileTree(tree *parser.Tree, config *conf.Config) (*vm.Program, error) {
+	if err := prepare(tree, config); err != nil {
+		return nil, err
+	}
+
+	_, err := checker.Check(tree, config)
+	if err != nil {
+		return nil, err
 	}
 
 	if config.Optimize {
@@ -182,7 +302,53 @@ func Compile(input string, ops ...Option) (*vm.Program, error) {
 	return program, nil
 }
 
+// Format parses input expression and returns its source in canonical form.
+// It does not type check the expression.
+func Format(input string) (string, error) {
+	tree, err := parser.Parse(input)
+	if err != nil {
+		return "", err
+	}
+	return ast.Format(tree.Node), nil
+}
+
 // Run evaluates given bytecode program.
 func Run(program *vm.Program, env interface{}) (interface{}, error) {
 	return vm.Run(program, env)
 }
+
+// RunBatch evaluates given bytecode program over every env of envs slice.
+// Outputs and per-env errors are returned in the order of envs.
+func RunBatch(program *vm.Program, envs interface{}, opts vm.BatchOptions) ([]interface{}, []error, error) {
+	return vm.RunBatch(program, envs, opts)
+}
+
+// RunColumnar evaluates given bytecode program over columns of data.
+// See columnar.Run for details.
+func RunColumnar(program *vm.Program, columns map[string]interface{}) (interface{}, error) {
+	return columnar.Run(program, columns)
+}
+
+// Unknown is a result of RunKleene when it depends on missing variables.
+var Unknown = vm.Unknown
+
+// RunKleene evaluates given bytecode program in three-valued mode,
+// missing variables evaluate to Unknown instead of an error.
+func RunKleene(program *vm.Program, env interface{}) (interface{}, error) {
+	return vm.RunKleene(program, env)
+}
+
+// RunWithTracer evaluates given bytecode program and reports execution to tracer.
+func RunWithTracer(program *vm.Program, env interface{}, tracer vm.Tracer) (interface{}, error) {
+	return vm.RunWithTracer(program, env, tracer)
+}
+
+// Explain evaluates given bytecode program and records value of every sub-expression.
+func Explain(program *vm.Program, env interface{}) (*vm.Explanation, error) {
+	return vm.Explain(program, env)
+}
+
+// NewCoverage creates branch coverage recorder for given bytecode program.
+func NewCoverage(program *vm.Program) (*vm.Coverage, error) {
+	return vm.NewCoverage(program)
+}
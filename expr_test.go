@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"math/rand"
 	"reflect"
 	"strings"
 	"testing"
@@ -362,6 +363,448 @@ func ExamplePatch() {
 	// Output : Hello, you, world!
 }
 
+func ExampleExplain() {
+	env := map[string]interface{}{
+		"user": map[string]interface{}{
+			"age":     21,
+			"country": "FR",
+		},
+	}
+
+	program, err := jsexpr.Compile(`user.age > 18 and user.country in ["US", "CA"] or user.age > 60`, jsexpr.TypeCheck(env))
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	explanation, err := jsexpr.Explain(program, env)
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	fmt.Print(explanation)
+
+	// Output: or (1:48) = false
+	//   and (1:15) = false
+	//     > (1:10) = true
+	//       .age (1:6) = 21
+	//         user (1:1) = map[age:21 country:FR]
+	//       18 (1:12) = 18
+	//     in (1:32) = false
+	//       .country (1:24) = "FR"
+	//         user (1:19) = map[age:21 country:FR]
+	//       ["CA", "US"] = ["CA", "US"]
+	//   > (1:60) = false
+	//     .age (1:56) = 21
+	//       user (1:51) = map[age:21 country:FR]
+	//     60 (1:62) = 60
+}
+
+func TestExplain_short_circuit(t *testing.T) {
+	env := map[string]interface{}{
+		"a":  true,
+		"xs": []int{1, 2, 3},
+	}
+
+	program, err := jsexpr.Compile(`a or b(1)`, jsexpr.AllowUndefinedVariables())
+	require.NoError(t, err)
+
+	explanation, err := jsexpr.Explain(program, env)
+	require.NoError(t, err)
+	require.Equal(t, true, explanation.Output)
+	require.Len(t, explanation.Nodes, 4)
+	require.False(t, explanation.Nodes[1].ShortCircuited())
+	require.True(t, explanation.Nodes[2].ShortCircuited())
+	require.True(t, explanation.Nodes[3].ShortCircuited())
+
+	program, err = jsexpr.Compile(`count(xs, {# > 1})`, jsexpr.TypeCheck(env))
+	require.NoError(t, err)
+
+	explanation, err = jsexpr.Explain(program, env)
+	require.NoError(t, err)
+	require.Equal(t, 2, explanation.Output)
+	require.Equal(t, 3, explanation.Nodes[2].Count)
+	require.Equal(t, true, explanation.Nodes[2].Value)
+}
+
+func TestExplain_conditional(t *testing.T) {
+	program, err := jsexpr.Compile(`a ? 1 : 2`, jsexpr.AllowUndefinedVariables())
+	require.NoError(t, err)
+
+	explanation, err := jsexpr.Explain(program, map[string]interface{}{"a": true})
+	require.NoError(t, err)
+	require.Equal(t, "?: (1:3) = 1\n  a (1:1) = true\n  1 (1:5) = 1\n  2 (1:9) short-circuited\n", explanation.String())
+}
+
+func TestExplain_field(t *testing.T) {
+	type address struct {
+		City string `jsexpr:"city"`
+	}
+	type user struct {
+		Address address `jsexpr:"address"`
+	}
+	env := struct {
+		User user `jsexpr:"user"`
+	}{User: user{Address: address{City: "Paris"}}}
+
+	program, err := jsexpr.Compile(`user.address.city == "Paris" ? 1 : 2`, jsexpr.TypeCheck(env))
+	require.NoError(t, err)
+
+	explanation, err := jsexpr.Explain(program, env)
+	require.NoError(t, err)
+	require.Equal(t, `?: (1:30) = 1
+  == (1:19) = true
+    .city (1:14) = "Paris"
+      .address (1:6) = {Paris}
+        user (1:1) = {{Paris}}
+    "Paris" (1:22) = "Paris"
+  1 (1:32) = 1
+  2 (1:36) short-circuited
+`, explanation.String())
+}
+
+func ExampleNewCoverage() {
+	program, err := jsexpr.Compile(`age > 18 and country in ["US", "CA"] ? "promo" : "none"`)
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	coverage, err := jsexpr.NewCoverage(program)
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	fixtures := []map[string]interface{}{
+		{"age": 21, "country": "US"},
+		{"age": 30, "country": "FR"},
+	}
+	for _, env := range fixtures {
+		_, err = coverage.Run(env)
+		if err != nil {
+			fmt.Printf("%v", err)
+			return
+		}
+	}
+
+	fmt.Print(coverage.Report())
+
+	// Output: 3 of 4 branches covered in 2 runs
+	// left side of and is never false (1:5)
+	//  | age > 18 and country in ["US", "CA"] ? "promo" : "none"
+	//  | ....^
+}
+
+func TestCoverage_predicate(t *testing.T) {
+	program, err := jsexpr.Compile(`all(xs, {# > 0}) or none(xs, {# > 5})`)
+	require.NoError(t, err)
+
+	coverage, err := jsexpr.NewCoverage(program)
+	require.NoError(t, err)
+
+	_, err = coverage.Run(map[string]interface{}{"xs": []int{1, 2}})
+	require.NoError(t, err)
+
+	report := coverage.Report()
+	require.Len(t, report.Branches, 3)
+	require.Equal(t, "predicate", report.Branches[1].Kind)
+	require.Equal(t, 2, report.Branches[1].True)
+	require.Equal(t, 0, report.Branches[1].False)
+	require.Equal(t, "or", report.Branches[0].Kind)
+	require.Equal(t, 0, report.Branches[2].True)
+	require.Len(t, report.Uncovered(), 3)
+	require.Equal(t, 2, report.Covered())
+}
+
+type lazyEnv struct {
+	Country  string
+	resolved []string
+}
+
+func (e *lazyEnv) Resolve(name string) (interface{}, bool) {
+	e.resolved = append(e.resolved, name)
+	switch name {
+	case "profile":
+		return map[string]interface{}{"age": 30}, true
+	case "risk":
+		return 0.2, true
+	}
+	return nil, false
+}
+
+func TestResolver(t *testing.T) {
+	program, err := jsexpr.Compile(`profile.age > 18 and profile.age < 65 and Country == "US" or risk > 0.5`, jsexpr.AllowUndefinedVariables())
+	require.NoError(t, err)
+
+	env := &lazyEnv{Country: "US"}
+	out, err := jsexpr.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+	require.Equal(t, []string{"profile", "Country"}, env.resolved)
+
+	// Memoization is per run.
+	env.resolved = nil
+	_, err = jsexpr.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, []string{"profile", "Country"}, env.resolved)
+
+	// Unresolved names are memoized too.
+	program, err = jsexpr.Compile(`Country + Country + Country`, jsexpr.AllowUndefinedVariables())
+	require.NoError(t, err)
+
+	env.resolved = nil
+	out, err = jsexpr.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, "USUSUS", out)
+	require.Equal(t, []string{"Country"}, env.resolved)
+}
+
+type lazyMap map[string]interface{}
+
+func (m lazyMap) Resolve(name string) (interface{}, bool) {
+	if name == "risk" {
+		return 0.2, true
+	}
+	return nil, false
+}
+
+func TestResolver_map(t *testing.T) {
+	program, err := jsexpr.Compile(`risk < limit`, jsexpr.TypeCheck(map[string]interface{}{"risk": 0.0, "limit": 0.0}))
+	require.NoError(t, err)
+
+	out, err := jsexpr.Run(program, lazyMap{"limit": 0.5})
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+
+	out, err = jsexpr.Run(program, map[string]interface{}{"risk": 0.7, "limit": 0.5})
+	require.NoError(t, err)
+	require.Equal(t, false, out)
+}
+
+func ExampleDependencies() {
+	code := `user.address.city == "Berlin" and all(orders, {.total > Math.max(limit, 10)}) and user.fullName() != ""`
+
+	program, err := jsexpr.Compile(code, jsexpr.AllowUndefinedVariables())
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	deps, err := jsexpr.Dependencies(program)
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	fmt.Println(deps.Variables)
+	fmt.Println(deps.Paths)
+	fmt.Println(deps.Methods)
+	fmt.Println(deps.Builtins)
+
+	// Output:
+	// [limit orders user]
+	// [limit orders orders[*].total user user.address.city]
+	// [Math.max user.fullName]
+	// [Math]
+}
+
+func TestTreeDependencies(t *testing.T) {
+	tree, err := parser.Parse(`map(filter(items, {#.tags[0] == tag}), {parseInt(#.values[key])}) + sum(data["a"].b, x[1:2])`)
+	require.NoError(t, err)
+
+	deps := jsexpr.TreeDependencies(tree)
+	require.Equal(t, []string{"data", "items", "key", "tag", "x"}, deps.Variables)
+	require.Equal(t, []string{"data.a.b", "items", "items[*].tags[0]", "items[*].values[*]", "key", "tag", "x"}, deps.Paths)
+	require.Equal(t, []string{"sum"}, deps.Functions)
+	require.Equal(t, []string{"parseInt"}, deps.Builtins)
+
+	tree, err = parser.Parse(`all(map(users, {#.address}), {#.city == city}) and any(map([1, 2], {#}), {# > 0})`)
+	require.NoError(t, err)
+
+	deps = jsexpr.TreeDependencies(tree)
+	require.Equal(t, []string{"city", "users", "users[*].address", "users[*].address.city"}, deps.Paths)
+}
+
+func TestTreeDependencies_tolerant(t *testing.T) {
+	tree, _ := parser.ParseTolerant(`a + user.address.`)
+
+	deps := jsexpr.TreeDependencies(tree)
+	require.Equal(t, []string{"a", "user"}, deps.Variables)
+	require.Equal(t, []string{"a", "user.address"}, deps.Paths)
+}
+
+func ExampleKnown() {
+	code := `country == "US" and age > 18`
+
+	for _, country := range []string{"US", "FR"} {
+		program, err := jsexpr.Compile(code, jsexpr.Known(map[string]interface{}{"country": country}))
+		if err != nil {
+			fmt.Printf("%v", err)
+			return
+		}
+
+		output, err := jsexpr.Run(program, map[string]interface{}{"age": 21})
+		if err != nil {
+			fmt.Printf("%v", err)
+			return
+		}
+		fmt.Printf("%v %v\n", country, output)
+	}
+
+	// Output: US true
+	// FR false
+}
+
+func TestKnown_residual(t *testing.T) {
+	program, err := jsexpr.Compile(`country == "FR" and age > 18`, jsexpr.Known(map[string]interface{}{"country": "US"}))
+	require.NoError(t, err)
+
+	deps, err := jsexpr.Dependencies(program)
+	require.NoError(t, err)
+	require.Empty(t, deps.Variables)
+
+	output, err := jsexpr.Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, false, output)
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func ExampleRandSource() {
+	at := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// Replay evaluates program with the same clock and seed.
+	replay := func() interface{} {
+		program, err := jsexpr.Compile(
+			`[Date.now(), Math.floor(Math.random() * 100), Math.floor(Math.random() * 100)]`,
+			jsexpr.Clock(fixedClock(at)),
+			jsexpr.RandSource(rand.NewSource(7)),
+		)
+		if err != nil {
+			return err
+		}
+		output, err := jsexpr.Run(program, nil)
+		if err != nil {
+			return err
+		}
+		return output
+	}
+
+	fmt.Printf("%v\n%v\n", replay(), replay())
+
+	// Output: [1622505600000 91 23]
+	// [1622505600000 91 23]
+}
+
+func ExampleRunKleene() {
+	program, err := jsexpr.Compile(`age >= 18 and country in ["US", "CA"]`, jsexpr.AllowUndefinedVariables())
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	envs := []map[string]interface{}{
+		{"age": 16},
+		{"age": 21},
+		{"age": 21, "country": "US"},
+	}
+	for _, env := range envs {
+		output, err := jsexpr.RunKleene(program, env)
+		if err != nil {
+			fmt.Printf("%v", err)
+			return
+		}
+		fmt.Println(output)
+	}
+
+	// Output: false
+	// unknown
+	// true
+}
+
+func ExampleCompileAST() {
+	// Tree of `price * quantity > 100` as sent by a visual editor.
+	data := []byte(`{
+		"kind": "BinaryNode",
+		"operator": ">",
+		"left": {
+			"kind": "BinaryNode",
+			"operator": "*",
+			"left": {"kind": "IdentifierNode", "value": "price"},
+			"right": {"kind": "IdentifierNode", "value": "quantity"}
+		},
+		"right": {"kind": "IntegerNode", "value": 100}
+	}`)
+
+	node, err := ast.UnmarshalJSON(data)
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	env := map[string]interface{}{"price": 25, "quantity": 5}
+	program, err := jsexpr.CompileAST(node, jsexpr.TypeCheck(env))
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	output, err := jsexpr.Run(program, env)
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	fmt.Printf("%v", output)
+
+	// Output: true
+}
+
+func ExampleFormat() {
+	source, err := jsexpr.Format(`user.Age>=18&&user.Country in ['US','CA']&&!user.Banned&&user.Name!=''`)
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	fmt.Println(source)
+
+	// Output: user.Age >= 18
+	//	and user.Country in ["US", "CA"]
+	//	and not user.Banned
+	//	and user.Name != ""
+}
+
+func ExampleAnalyze() {
+	type User struct {
+		Age  int    `jsexpr:"age"`
+		Name string `jsexpr:"name"`
+	}
+	type Env struct {
+		User User `jsexpr:"user"`
+	}
+
+	input := `user.Age > "18" and user.email != ""`
+	diagnostics := jsexpr.Analyze(input, jsexpr.TypeCheck(Env{}))
+
+	fmt.Println(diagnostics.Format(file.NewSource(input)))
+
+	// Output: error[unknown-field]: type jsexpr_test.User has no field Age (1:6)
+	//  | user.Age > "18" and user.email != ""
+	//  | .....^^^
+	//  = did you mean age?
+	//
+	// error[unknown-field]: type jsexpr_test.User has no field email (1:26)
+	//  | user.Age > "18" and user.email != ""
+	//  | .........................^^^^^
+}
+
 func TestOperator_struct(t *testing.T) {
 	env := &mockEnv{
 		BirthDay: time.Date(2017, time.October, 23, 18, 30, 0, 0, time.UTC),
@@ -968,13 +1411,13 @@ func TestCompile_exposed_error(t *testing.T) {
 
 	fileError, ok := err.(*file.Error)
 	require.True(t, ok, "error should be of type *file.Error")
-	require.Equal(t, "invalid operation: == (mismatched types int and bool) (1:3)\n | 1 == true\n | ..^", fileError.Error())
+	require.Equal(t, "invalid operation: == (mismatched types int and bool) (1:3)\n | 1 == true\n | ..^^^^^^^", fileError.Error())
 	require.Equal(t, 2, fileError.Column)
 	require.Equal(t, 1, fileError.Line)
 
 	b, err := json.Marshal(err)
 	require.NoError(t, err)
-	require.Equal(t, `{"Line":1,"Column":2,"Message":"invalid operation: == (mismatched types int and bool)","Snippet":"\n | 1 == true\n | ..^"}`, string(b))
+	require.Equal(t, `{"Line":1,"Column":2,"Message":"invalid operation: == (mismatched types int and bool)","Snippet":"\n | 1 == true\n | ..^^^^^^^"}`, string(b))
 }
 
 func TestAsBool_exposed_error_(t *testing.T) {
@@ -1869,3 +2312,93 @@ func TestParseInt(t *testing.T) {
 	// assert.Nil(t, err)
 	// assert.Equal(t, "", out)
 }
+
+func TestAnalyze(t *testing.T) {
+	env := map[string]interface{}{
+		"name":  "",
+		"age":   0,
+		"items": []int{},
+	}
+
+	diagnostics := jsexpr.Analyze(`Name + 1 > age and all(items, {# matches 1}) and foo()`, jsexpr.TypeCheck(env))
+	require.Len(t, diagnostics, 3)
+
+	require.Equal(t, file.Diagnostic{
+		Severity: file.SeverityError,
+		Code:     "unknown-name",
+		Message:  "unknown name Name",
+		Location: file.Location{Line: 1, Column: 0},
+		Range:    file.Range{Start: file.Location{Line: 1, Column: 0}, End: file.Location{Line: 1, Column: 4}, Offset: 0, EndOffset: 4},
+		Fix: &file.Fix{
+			Message: "did you mean name?",
+			Range:   file.Range{Start: file.Location{Line: 1, Column: 0}, End: file.Location{Line: 1, Column: 4}, Offset: 0, EndOffset: 4},
+			Text:    "name",
+		},
+	}, diagnostics[0])
+	require.Equal(t, "mismatched-types", diagnostics[1].Code)
+	require.Equal(t, file.Range{Start: file.Location{Line: 1, Column: 31}, End: file.Location{Line: 1, Column: 42}, Offset: 31, EndOffset: 42}, diagnostics[1].Range)
+	require.Equal(t, "unknown-func", diagnostics[2].Code)
+	require.True(t, diagnostics.HasErrors())
+
+	data, err := json.Marshal(diagnostics[2])
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"severity": "error",
+		"code": "unknown-func",
+		"message": "unknown func foo",
+		"location": {"line": 1, "column": 49},
+		"range": {"start": {"line": 1, "column": 49, "offset": 49}, "end": {"line": 1, "column": 52, "offset": 52}}
+	}`, string(data))
+
+	var decoded file.Diagnostic
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, diagnostics[2], decoded)
+}
+
+func TestAnalyze_syntax(t *testing.T) {
+	diagnostics := jsexpr.Analyze(`a matches "(" and 0x and b +`)
+	require.Len(t, diagnostics, 3)
+	require.Equal(t, "invalid-regexp", diagnostics[0].Code)
+	require.Equal(t, file.Range{Start: file.Location{Line: 1, Column: 10}, End: file.Location{Line: 1, Column: 13}, Offset: 10, EndOffset: 13}, diagnostics[0].Range)
+	require.Equal(t, "invalid-literal", diagnostics[1].Code)
+	require.Equal(t, file.Range{Start: file.Location{Line: 1, Column: 18}, End: file.Location{Line: 1, Column: 20}, Offset: 18, EndOffset: 20}, diagnostics[1].Range)
+	require.Equal(t, "syntax", diagnostics[2].Code)
+
+	require.Empty(t, jsexpr.Analyze(`1 + 2`))
+	require.Equal(t, "unexpected-type", jsexpr.Analyze(`1 + 2`, jsexpr.AsBool())[0].Code)
+	require.Equal(t, "config", jsexpr.Analyze(`1 + 2`, jsexpr.Operator("+", "add"))[0].Code)
+}
+
+func TestAnalyze_offset(t *testing.T) {
+	diagnostics := jsexpr.Analyze("'é' +\n  foo()", jsexpr.TypeCheck(map[string]interface{}{}))
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, file.Range{
+		Start:     file.Location{Line: 2, Column: 2},
+		End:       file.Location{Line: 2, Column: 5},
+		Offset:    8,
+		EndOffset: 11,
+	}, diagnostics[0].Range)
+}
+
+func TestAnalyze_location(t *testing.T) {
+	code := `"héllo" + 1 == ab`
+	env := jsexpr.TypeCheck(map[string]interface{}{})
+
+	_, err := jsexpr.Compile(code, env)
+	fileError, ok := err.(*file.Error)
+	require.True(t, ok, err)
+
+	diagnostics := jsexpr.Analyze(code, env)
+	require.Len(t, diagnostics, 2)
+	require.Equal(t, fileError.Location, diagnostics[0].Location)
+	require.Equal(t, "error[mismatched-types]: "+fileError.Error(), diagnostics[0].Error(file.NewSource(code)))
+}
+
+func TestAnalyze_operator(t *testing.T) {
+	code := `birthDay == "2017-10-23" and birthDay.year() == 2017`
+	ops := []jsexpr.Option{jsexpr.TypeCheck(&mockEnv{}), jsexpr.Operator("==", "dateEqual")}
+
+	_, err := jsexpr.Compile(code, ops...)
+	require.NoError(t, err)
+	require.Empty(t, jsexpr.Analyze(code, ops...))
+}
@@ -0,0 +1,181 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Severity of diagnostic.
+type Severity int
+
+const (
+	SeverityError Severity = iota + 1
+	SeverityWarning
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	for _, severity := range []Severity{SeverityError, SeverityWarning, SeverityInfo} {
+		if severity.String() == string(text) {
+			*s = severity
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Range is a part of source, End is exclusive. Offset and EndOffset
+// are character offsets of Start and End in source.
+type Range struct {
+	Start     Location
+	End       Location
+	Offset    int
+	EndOffset int
+}
+
+func (r Range) Empty() bool {
+	return r.Start.Empty() && r.End.Empty()
+}
+
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+type jsonRange struct {
+	Start jsonPosition `json:"start"`
+	End   jsonPosition `json:"end"`
+}
+
+func (r Range) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonRange{
+		Start: jsonPosition{Line: r.Start.Line, Column: r.Start.Column, Offset: r.Offset},
+		End:   jsonPosition{Line: r.End.Line, Column: r.End.Column, Offset: r.EndOffset},
+	})
+}
+
+func (r *Range) UnmarshalJSON(b []byte) error {
+	var j jsonRange
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	r.Start = Location{Line: j.Start.Line, Column: j.Start.Column}
+	r.End = Location{Line: j.End.Line, Column: j.End.Column}
+	r.Offset, r.EndOffset = j.Start.Offset, j.End.Offset
+	return nil
+}
+
+// Fix is a suggested edit: text replacing range of source.
+type Fix struct {
+	Message string `json:"message"`
+	Range   Range  `json:"range"`
+	Text    string `json:"text"`
+}
+
+// Diagnostic is a problem found in source. Code identifies kind
+// of the problem, like "unknown-name" or "mismatched-types".
+// Location is where the problem is reported, the same as in Error,
+// which may be inside of Range, like operator of binary expression.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Location Location `json:"-"`
+	Range    Range    `json:"range"`
+	Fix      *Fix     `json:"fix,omitempty"`
+}
+
+type jsonLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// diagnostic has fields of Diagnostic without its methods.
+type diagnostic Diagnostic
+
+type jsonDiagnostic struct {
+	diagnostic
+	Location *jsonLocation `json:"location,omitempty"`
+}
+
+func (d Diagnostic) MarshalJSON() ([]byte, error) {
+	j := jsonDiagnostic{diagnostic: diagnostic(d)}
+	if !d.Location.Empty() {
+		j.Location = &jsonLocation{Line: d.Location.Line, Column: d.Location.Column}
+	}
+	return json.Marshal(j)
+}
+
+func (d *Diagnostic) UnmarshalJSON(b []byte) error {
+	var j jsonDiagnostic
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*d = Diagnostic(j.diagnostic)
+	if j.Location != nil {
+		d.Location = Location{Line: j.Location.Line, Column: j.Location.Column}
+	}
+	return nil
+}
+
+// Error returns diagnostic in the format of Error, bound to source.
+func (d Diagnostic) Error(source *Source) string {
+	loc := d.Location
+	if loc.Empty() {
+		loc = d.Range.Start
+	}
+	e := &Error{
+		Location: loc,
+		Range:    d.Range,
+		Message:  fmt.Sprintf("%v[%v]: %v", d.Severity, d.Code, d.Message),
+	}
+	if source != nil {
+		e.Bind(source)
+	}
+	out := e.Error()
+	if d.Fix != nil {
+		out += "\n = " + d.Fix.Message
+	}
+	return out
+}
+
+// Diagnostics is a list of diagnostics ordered by location.
+type Diagnostics []Diagnostic
+
+// HasErrors reports whether some of diagnostics is an error.
+func (d Diagnostics) HasErrors() bool {
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Format returns diagnostics in the format of Error with snippets
+// of source, separated by blank lines.
+func (d Diagnostics) Format(source *Source) string {
+	out := make([]string, len(d))
+	for i, diagnostic := range d {
+		out[i] = diagnostic.Error(source)
+	}
+	return strings.Join(out, "\n\n")
+}
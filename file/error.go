@@ -2,12 +2,15 @@ package file
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"unicode/utf8"
 )
 
 type Error struct {
 	Location
+	// Range is underlined in snippet, if it is set.
+	Range   Range `json:"-"`
 	Message string
 	Snippet string
 }
@@ -22,7 +25,8 @@ func (e *Error) Bind(source *Source) *Error {
 		srcLine := "\n | " + snippet
 		var bytes = []byte(snippet)
 		var indLine = "\n | "
-		for i := 0; i < e.Location.Column && len(bytes) > 0; i++ {
+		start, end := e.underline()
+		for i := 0; i < start && len(bytes) > 0; i++ {
 			_, sz := utf8.DecodeRune(bytes)
 			bytes = bytes[sz:]
 			if sz > 1 {
@@ -31,9 +35,12 @@ func (e *Error) Bind(source *Source) *Error {
 				indLine += "."
 			}
 		}
-		if _, sz := utf8.DecodeRune(bytes); sz > 1 {
-			goto noind
-		} else {
+		for i := start; i < end && (i == start || len(bytes) > 0); i++ {
+			_, sz := utf8.DecodeRune(bytes)
+			if sz > 1 {
+				goto noind
+			}
+			bytes = bytes[sz:]
 			indLine += "^"
 		}
 		srcLine += indLine
@@ -44,6 +51,25 @@ func (e *Error) Bind(source *Source) *Error {
 	return e
 }
 
+// underline returns columns of snippet line to underline. It starts at
+// the column of error, which may be inside of range, like operator of
+// binary expression.
+func (e *Error) underline() (int, int) {
+	r := e.Range
+	if r.Empty() || r.Start.Line != e.Line || r.End.Line < r.Start.Line || e.Column < r.Start.Column {
+		return e.Column, e.Column + 1
+	}
+	end := r.End.Column
+	if r.End.Line > r.Start.Line {
+		// Underline till the end of line.
+		end = math.MaxInt32
+	}
+	if end <= e.Column {
+		end = e.Column + 1
+	}
+	return e.Column, end
+}
+
 func (e *Error) format() string {
 	if e.Location.Empty() {
 		return e.Message
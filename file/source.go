@@ -51,6 +51,20 @@ func (s *Source) Snippet(line int) (string, bool) {
 	return string(s.Contents[charStart:]), true
 }
 
+// Offset returns character offset of location in source.
+func (s *Source) Offset(loc Location) int {
+	offset, found := s.findLineOffset(loc.Line)
+	if !found {
+		return 0
+	}
+	return int(offset) + loc.Column
+}
+
+// Range returns range of source from start to end with their offsets.
+func (s *Source) Range(start, end Location) Range {
+	return Range{Start: start, End: end, Offset: s.Offset(start), EndOffset: s.Offset(end)}
+}
+
 // updateOffsets compute line offsets up front as they are referred to frequently.
 func (s *Source) updateOffsets() {
 	lines := strings.Split(string(s.Contents), "\n")
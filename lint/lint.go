@@ -0,0 +1,184 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/file"
+	"github.com/byte-power/jsexpr/parser"
+)
+
+// DefaultMaxNesting is the deepest nesting of conditionals and closures
+// allowed by deep-nesting rule, unless configured otherwise.
+const DefaultMaxNesting = 5
+
+// Rule is a check of expression, its name is the code of diagnostics
+// it reports.
+type Rule struct {
+	Name     string
+	Severity file.Severity // Default severity of diagnostics.
+	Doc      string
+	check    func(l *linter, node ast.Node)
+}
+
+// Rules are all rules, each of them is enabled by default.
+var Rules = []*Rule{
+	{
+		Name:     "constant-condition",
+		Severity: file.SeverityWarning,
+		Doc:      "Conditions which are always true or always false, like x == x or true and y.",
+		check:    constantCondition,
+	},
+	{
+		Name:     "impossible-comparison",
+		Severity: file.SeverityWarning,
+		Doc:      "Comparisons which result is known from types of operands, like age == nil or len(items) < 0.",
+		check:    impossibleComparison,
+	},
+	{
+		Name:     "suspicious-regexp",
+		Severity: file.SeverityWarning,
+		Doc:      "Invalid regexps and regexps with nested repetition, like (a+)+, on the right of matches.",
+		check:    suspiciousRegexp,
+	},
+	{
+		Name:     "float-equality",
+		Severity: file.SeverityInfo,
+		Doc:      "Floating point numbers compared with == or !=, which is sensitive to rounding errors.",
+		check:    floatEquality,
+	},
+	{
+		Name:     "unreachable-branch",
+		Severity: file.SeverityWarning,
+		Doc:      "Branches of conditionals which are never evaluated, like in true ? a : b.",
+		check:    unreachableBranch,
+	},
+	{
+		Name:     "double-negation",
+		Severity: file.SeverityInfo,
+		Doc:      "Redundant double negation, like not not x.",
+		check:    doubleNegation,
+	},
+	{
+		Name:     "deep-nesting",
+		Severity: file.SeverityInfo,
+		Doc:      "Conditionals and closures nested deeper than configured maximum.",
+		check:    deepNesting,
+	},
+}
+
+// Config selects rules and their severity. Zero value enables
+// all rules with default severity.
+type Config struct {
+	// Disabled are names of rules not to run.
+	Disabled []string `json:"disabled,omitempty"`
+	// Severity overrides default severity of rules by name.
+	Severity map[string]file.Severity `json:"severity,omitempty"`
+	// MaxNesting is the deepest nesting of conditionals and closures,
+	// DefaultMaxNesting if zero.
+	MaxNesting int `json:"maxNesting,omitempty"`
+}
+
+// Lint runs enabled rules over tree and returns diagnostics ordered by
+// location. Tree should be checked, otherwise rules depending on types
+// of nodes report nothing. Config may be nil.
+func Lint(tree *parser.Tree, config *Config) (file.Diagnostics, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	l := &linter{
+		maxNesting: config.MaxNesting,
+		severity:   make(map[*Rule]file.Severity),
+	}
+	if l.maxNesting <= 0 {
+		l.maxNesting = DefaultMaxNesting
+	}
+
+	disabled := make(map[*Rule]bool)
+	for _, name := range config.Disabled {
+		rule, err := find(name)
+		if err != nil {
+			return nil, err
+		}
+		disabled[rule] = true
+	}
+	for name, severity := range config.Severity {
+		rule, err := find(name)
+		if err != nil {
+			return nil, err
+		}
+		l.severity[rule] = severity
+	}
+	for _, rule := range Rules {
+		if !disabled[rule] {
+			l.rules = append(l.rules, rule)
+		}
+	}
+
+	ast.Walk(&tree.Node, l)
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i].Range.Start, l.diagnostics[j].Range.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return l.diagnostics, nil
+}
+
+func find(name string) (*Rule, error) {
+	for _, rule := range Rules {
+		if rule.Name == name {
+			return rule, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown lint rule %v", name)
+}
+
+type linter struct {
+	rules       []*Rule
+	severity    map[*Rule]file.Severity
+	maxNesting  int
+	nesting     int   // number of conditionals and closures around node
+	deep        bool  // deep nesting is already reported
+	rule        *Rule // rule being checked
+	diagnostics file.Diagnostics
+}
+
+func (l *linter) Enter(node *ast.Node) {
+	if nests(*node) {
+		l.nesting++
+	}
+	for _, rule := range l.rules {
+		l.rule = rule
+		rule.check(l, *node)
+	}
+}
+
+func (l *linter) Exit(node *ast.Node) {
+	if nests(*node) {
+		l.nesting--
+	}
+}
+
+func nests(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.ConditionalNode, *ast.ClosureNode:
+		return true
+	}
+	return false
+}
+
+// report adds diagnostic of rule being checked for range of node.
+func (l *linter) report(node ast.Node, format string, args ...interface{}) {
+	severity, ok := l.severity[l.rule]
+	if !ok {
+		severity = l.rule.Severity
+	}
+	l.diagnostics = append(l.diagnostics, file.Diagnostic{
+		Severity: severity,
+		Code:     l.rule.Name,
+		Message:  fmt.Sprintf(format, args...),
+		Location: node.Location(),
+		Range:    node.Range(),
+	})
+}
@@ -0,0 +1,134 @@
+package lint_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/byte-power/jsexpr/checker"
+	"github.com/byte-power/jsexpr/conf"
+	"github.com/byte-power/jsexpr/file"
+	"github.com/byte-power/jsexpr/lint"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/stretchr/testify/require"
+)
+
+type Env struct {
+	Age   int     `jsexpr:"age"`
+	Score float64 `jsexpr:"score"`
+	Name  string  `jsexpr:"name"`
+	Items []int   `jsexpr:"items"`
+	Count uint    `jsexpr:"count"`
+	Ok    bool    `jsexpr:"ok"`
+	Rand  func() int
+}
+
+func analyze(t *testing.T, input string, config *lint.Config) file.Diagnostics {
+	tree, err := parser.Parse(input)
+	require.NoError(t, err, input)
+	_, err = checker.Check(tree, conf.New(Env{}))
+	require.NoError(t, err, input)
+
+	diagnostics, err := lint.Lint(tree, config)
+	require.NoError(t, err, input)
+	return diagnostics
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		input   string
+		code    string
+		message string
+	}{
+		{`age == age`, "constant-condition", "condition is always true, operands are the same"},
+		{`name < name`, "constant-condition", "condition is always false, operands are the same"},
+		{`true and ok`, "constant-condition", "operand true has no effect on and"},
+		{`ok || true`, "constant-condition", "condition is always true"},
+		{`not false`, "constant-condition", "condition is always true"},
+		{`age == nil`, "impossible-comparison", "comparison is always false, int is never nil"},
+		{`age != 1.5`, "impossible-comparison", "comparison is always true, int is never 1.5"},
+		{`len(items) < 0`, "impossible-comparison", "comparison is always false, len(items) is never negative"},
+		{`0 <= count`, "impossible-comparison", "comparison is always true, count is never negative"},
+		{`name matches "(a+)+b"`, "suspicious-regexp", "regexp has nested repetition (a+)+"},
+		{`name matches "x(b|c*)*"`, "suspicious-regexp", "regexp has nested repetition (b|c*)*"},
+		{`score == 1.0`, "float-equality", "floating point numbers compared with =="},
+		{`score != score`, "float-equality", "floating point numbers compared with !="},
+		{`true ? 1 : 2`, "unreachable-branch", "branch is never evaluated, condition is always true"},
+		{`ok ? 1 : ok ? 2 : 3`, "unreachable-branch", "branch is never evaluated, condition is checked to be false"},
+		{`not not ok`, "double-negation", "double negation is redundant"},
+		{`all(items, {all(items, {all(items, {all(items, {all(items, {all(items, {# > 0})})})})})})`, "deep-nesting", "nesting depth 6 exceeds 5"},
+	}
+
+	for _, test := range tests {
+		diagnostics := analyze(t, test.input, nil)
+		require.Len(t, diagnostics, 1, test.input)
+		require.Equal(t, test.code, diagnostics[0].Code, test.input)
+		require.Equal(t, test.message, diagnostics[0].Message, test.input)
+	}
+}
+
+func TestLint_clean(t *testing.T) {
+	tests := []string{
+		`age >= 18 and name startsWith "A"`,
+		`Rand() == Rand()`,
+		`items == nil or len(items) > 0`,
+		`name matches "^a+b*$"`,
+		`ok ? (age > 1 ? 1 : 2) : 3`,
+		`not (age > 1)`,
+		`age == 1.0`,
+		`score <= score`,
+	}
+
+	for _, input := range tests {
+		require.Empty(t, analyze(t, input, nil), input)
+	}
+}
+
+func TestLint_range(t *testing.T) {
+	diagnostics := analyze(t, `ok and (true ? age : 0) > 1`, nil)
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, file.Range{
+		Start:     file.Location{Line: 1, Column: 21},
+		End:       file.Location{Line: 1, Column: 22},
+		Offset:    21,
+		EndOffset: 22,
+	}, diagnostics[0].Range)
+}
+
+func TestLint_tolerant(t *testing.T) {
+	tree, _ := parser.ParseTolerant(`(age == age.) or (name < ) or len(items) < 0 or`)
+
+	diagnostics, err := lint.Lint(tree, nil)
+	require.NoError(t, err)
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, "impossible-comparison", diagnostics[0].Code)
+}
+
+func TestLint_config(t *testing.T) {
+	input := `not not ok and score != 0.5`
+
+	diagnostics := analyze(t, input, nil)
+	require.Len(t, diagnostics, 2)
+	require.Equal(t, "double-negation", diagnostics[0].Code)
+	require.Equal(t, file.SeverityInfo, diagnostics[0].Severity)
+
+	var config lint.Config
+	err := json.Unmarshal([]byte(`{
+		"disabled": ["float-equality"],
+		"severity": {"double-negation": "error"}
+	}`), &config)
+	require.NoError(t, err)
+
+	diagnostics = analyze(t, input, &config)
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, "double-negation", diagnostics[0].Code)
+	require.Equal(t, file.SeverityError, diagnostics[0].Severity)
+
+	diagnostics = analyze(t, `ok ? (ok ? 1 : 2) : 3`, &lint.Config{Disabled: []string{"unreachable-branch"}, MaxNesting: 1})
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, "nesting depth 2 exceeds 1", diagnostics[0].Message)
+
+	tree, err := parser.Parse(input)
+	require.NoError(t, err)
+	_, err = lint.Lint(tree, &lint.Config{Disabled: []string{"foo"}})
+	require.EqualError(t, err, "unknown lint rule foo")
+}
@@ -0,0 +1,296 @@
+package lint
+
+import (
+	"math"
+	"reflect"
+	"regexp"
+	"regexp/syntax"
+
+	"github.com/byte-power/jsexpr/ast"
+)
+
+func constantCondition(l *linter, node ast.Node) {
+	switch n := node.(type) {
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "==", "<=", ">=", "!=", "<", ">":
+			// Float operand may be NaN, x != x is the test for it.
+			if same(n.Left, n.Right) && !isFloat(n.Left.Type()) {
+				always := n.Operator == "==" || n.Operator == "<=" || n.Operator == ">="
+				l.report(n, "condition is always %v, operands are the same", always)
+			}
+		case "and", "&&", "or", "||":
+			for _, operand := range []ast.Node{n.Left, n.Right} {
+				b, ok := operand.(*ast.BoolNode)
+				if !ok {
+					continue
+				}
+				and := n.Operator == "and" || n.Operator == "&&"
+				if b.Value == and {
+					l.report(n, "operand %v has no effect on %v", b.Value, n.Operator)
+				} else {
+					l.report(n, "condition is always %v", b.Value)
+				}
+				break
+			}
+		}
+	case *ast.UnaryNode:
+		if b, ok := n.Node.(*ast.BoolNode); ok && negation(n) {
+			l.report(n, "condition is always %v", !b.Value)
+		}
+	}
+}
+
+func impossibleComparison(l *linter, node ast.Node) {
+	n, ok := node.(*ast.BinaryNode)
+	if !ok {
+		return
+	}
+	operator, left, right := n.Operator, n.Left, n.Right
+	if isConstant(left) && !isConstant(right) {
+		operator, left, right = flip(operator), right, left
+	}
+
+	switch operator {
+	case "==", "!=":
+		if _, ok := right.(*ast.NilNode); ok && !nilable(left.Type()) {
+			l.report(n, "comparison is always %v, %v is never nil", operator == "!=", left.Type())
+			return
+		}
+		if f, ok := right.(*ast.FloatNode); ok && isInteger(left.Type()) && f.Value != math.Trunc(f.Value) {
+			l.report(n, "comparison is always %v, %v is never %v", operator == "!=", left.Type(), f.Value)
+			return
+		}
+	}
+
+	c, ok := integer(right)
+	if !ok || !nonNegative(left) {
+		return
+	}
+	var always bool
+	switch {
+	case operator == "<" && c <= 0, operator == "<=" && c < 0, operator == "==" && c < 0:
+		always = false
+	case operator == ">=" && c <= 0, operator == ">" && c < 0, operator == "!=" && c < 0:
+		always = true
+	default:
+		return
+	}
+	l.report(n, "comparison is always %v, %v is never negative", always, ast.Print(left))
+}
+
+func suspiciousRegexp(l *linter, node ast.Node) {
+	n, ok := node.(*ast.MatchesNode)
+	if !ok {
+		return
+	}
+	s, ok := n.Right.(*ast.StringNode)
+	if !ok {
+		return
+	}
+	if _, err := regexp.Compile(s.Value); err != nil {
+		l.report(s, "invalid regexp: %v", err)
+		return
+	}
+	re, err := syntax.Parse(s.Value, syntax.Perl)
+	if err != nil {
+		return
+	}
+	if nested := nestedRepeat(re, false); nested != nil {
+		l.report(s, "regexp has nested repetition %v", nested)
+	}
+}
+
+func floatEquality(l *linter, node ast.Node) {
+	n, ok := node.(*ast.BinaryNode)
+	if !ok || n.Operator != "==" && n.Operator != "!=" {
+		return
+	}
+	for _, operand := range []ast.Node{n.Left, n.Right} {
+		if _, ok := operand.(*ast.FloatNode); !ok && isFloat(operand.Type()) {
+			l.report(n, "floating point numbers compared with %v", n.Operator)
+			return
+		}
+	}
+}
+
+func unreachableBranch(l *linter, node ast.Node) {
+	n, ok := node.(*ast.ConditionalNode)
+	if !ok {
+		return
+	}
+	if b, ok := n.Cond.(*ast.BoolNode); ok {
+		if b.Value {
+			l.report(n.Exp2, "branch is never evaluated, condition is always true")
+		} else if n.Exp1 != n.Cond {
+			l.report(n.Exp1, "branch is never evaluated, condition is always false")
+		}
+		return
+	}
+	// Nested conditional repeating condition takes the same branch.
+	if inner, ok := n.Exp1.(*ast.ConditionalNode); ok && n.Exp1 != n.Cond && same(inner.Cond, n.Cond) {
+		l.report(inner.Exp2, "branch is never evaluated, condition is checked to be true")
+	}
+	if inner, ok := n.Exp2.(*ast.ConditionalNode); ok && same(inner.Cond, n.Cond) {
+		l.report(inner.Exp1, "branch is never evaluated, condition is checked to be false")
+	}
+}
+
+func doubleNegation(l *linter, node ast.Node) {
+	n, ok := node.(*ast.UnaryNode)
+	if !ok || !negation(n) {
+		return
+	}
+	if inner, ok := n.Node.(*ast.UnaryNode); ok && negation(inner) {
+		l.report(n, "double negation is redundant")
+	}
+}
+
+func deepNesting(l *linter, node ast.Node) {
+	if nests(node) && l.nesting > l.maxNesting && !l.deep {
+		l.deep = true
+		l.report(node, "nesting depth %v exceeds %v", l.nesting, l.maxNesting)
+	}
+}
+
+func negation(n *ast.UnaryNode) bool {
+	return n.Operator == "not" || n.Operator == "!"
+}
+
+// same reports whether nodes are the same expression without calls,
+// so they always evaluate to the same value.
+func same(a, b ast.Node) bool {
+	return pure(a) && pure(b) && ast.Print(a) == ast.Print(b)
+}
+
+// pure reports whether node has no calls, which may return
+// different values each time, and no invalid syntax.
+func pure(node ast.Node) bool {
+	p := &purity{pure: true}
+	ast.Walk(&node, p)
+	return p.pure
+}
+
+type purity struct {
+	pure bool
+}
+
+func (p *purity) Enter(node *ast.Node) {
+	switch (*node).(type) {
+	case *ast.FunctionNode, *ast.MethodNode, *ast.BuiltinNode, *ast.ErrorNode:
+		p.pure = false
+	}
+}
+
+func (p *purity) Exit(node *ast.Node) {}
+
+func isConstant(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.NilNode, *ast.IntegerNode, *ast.FloatNode, *ast.BoolNode, *ast.StringNode, *ast.ConstantNode:
+		return true
+	case *ast.UnaryNode:
+		_, ok := integer(node)
+		return ok
+	}
+	return false
+}
+
+// integer returns value of integer literal, which may be negated.
+func integer(node ast.Node) (int, bool) {
+	switch n := node.(type) {
+	case *ast.IntegerNode:
+		return n.Value, true
+	case *ast.UnaryNode:
+		if i, ok := n.Node.(*ast.IntegerNode); ok && n.Operator == "-" {
+			return -i.Value, true
+		}
+	}
+	return 0, false
+}
+
+// flip returns operator with swapped operands.
+func flip(operator string) string {
+	switch operator {
+	case "<":
+		return ">"
+	case ">":
+		return "<"
+	case "<=":
+		return ">="
+	case ">=":
+		return "<="
+	}
+	return operator
+}
+
+// nonNegative reports whether node is length or of unsigned type.
+func nonNegative(node ast.Node) bool {
+	if b, ok := node.(*ast.BuiltinNode); ok && b.Name == "len" {
+		return true
+	}
+	if t := dereference(node.Type()); t != nil {
+		switch t.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		}
+	}
+	return false
+}
+
+func nilable(t reflect.Type) bool {
+	if t == nil {
+		return true // Unknown type.
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return true
+	}
+	return false
+}
+
+// isInteger and isFloat are unlike ones of checker, interfaces
+// are not of the kind.
+func isInteger(t reflect.Type) bool {
+	t = dereference(t)
+	if t == nil {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isFloat(t reflect.Type) bool {
+	t = dereference(t)
+	if t == nil {
+		return false
+	}
+	return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+}
+
+func dereference(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// nestedRepeat returns unbounded repetition of re, which contains another one.
+func nestedRepeat(re *syntax.Regexp, repeated bool) *syntax.Regexp {
+	unbounded := re.Op == syntax.OpStar || re.Op == syntax.OpPlus || re.Op == syntax.OpRepeat && re.Max == -1
+	if unbounded && repeated {
+		return re
+	}
+	for _, sub := range re.Sub {
+		if nested := nestedRepeat(sub, repeated || unbounded); nested != nil {
+			if unbounded && !repeated {
+				return re
+			}
+			return nested
+		}
+	}
+	return nil
+}
@@ -117,6 +117,77 @@ func TestOptimize_const_expr(t *testing.T) {
 	assert.Equal(t, ast.Dump(expected), ast.Dump(tree.Node))
 }
 
+func TestPartial(t *testing.T) {
+	tests := []struct {
+		input    string
+		known    map[string]interface{}
+		expected ast.Node
+	}{
+		{
+			`country == "US" and age > 18`,
+			map[string]interface{}{"country": "US"},
+			&ast.BinaryNode{
+				Operator: ">",
+				Left:     &ast.IdentifierNode{Value: "age"},
+				Right:    &ast.IntegerNode{Value: 18},
+			},
+		},
+		{
+			`country == "US" and age > 18`,
+			map[string]interface{}{"country": "FR"},
+			&ast.BoolNode{Value: false},
+		},
+		{
+			`age > 18 or user.region in ["EU", "US"]`,
+			map[string]interface{}{"user": map[string]interface{}{"region": "EU"}},
+			&ast.BoolNode{Value: true},
+		},
+		{
+			`premium ? price * (1 - discount) : price`,
+			map[string]interface{}{"premium": true, "discount": 0.25},
+			&ast.BinaryNode{
+				Operator: "*",
+				Left:     &ast.IdentifierNode{Value: "price"},
+				Right:    &ast.FloatNode{Value: 0.75},
+			},
+		},
+		{
+			`count(tiers, {# > limit}) > 0 && ok`,
+			map[string]interface{}{"tiers": []int{1, 5, 10}, "limit": 3},
+			&ast.IdentifierNode{Value: "ok"},
+		},
+		{
+			`name[0:n]`,
+			map[string]interface{}{"n": 2},
+			&ast.SliceNode{
+				Node: &ast.IdentifierNode{Value: "name"},
+				From: &ast.IntegerNode{Value: 0},
+				To:   &ast.IntegerNode{Value: 2},
+			},
+		},
+		{
+			`tiers[1:] == tiers[n:]`,
+			map[string]interface{}{"tiers": []int{1, 5, 10}},
+			&ast.BinaryNode{
+				Operator: "==",
+				Left:     &ast.ConstantNode{Value: []int{5, 10}},
+				Right: &ast.SliceNode{
+					Node: &ast.ConstantNode{Value: []int{1, 5, 10}},
+					From: &ast.IdentifierNode{Value: "n"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		tree, err := parser.Parse(test.input)
+		require.NoError(t, err, test.input)
+
+		optimizer.Partial(&tree.Node, test.known)
+		assert.Equal(t, ast.Dump(test.expected), ast.Dump(tree.Node), test.input)
+	}
+}
+
 func Unix() int {
 	return testOne
 }
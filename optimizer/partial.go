@@ -0,0 +1,182 @@
+package optimizer
+
+import (
+	. "github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/compiler"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/byte-power/jsexpr/vm"
+)
+
+// Partial evaluates node against partially known env. Known variables are
+// replaced with their values, and every sub-expression which no longer
+// depends on env is evaluated and replaced with its result. Logical operators
+// and ternaries with known operands are reduced to the remaining part,
+// for example `country == "US" and age > 18` becomes `age > 18` if country
+// is "US" and `false` otherwise. Note what sub-expressions dropped this way
+// are never evaluated, so their runtime errors are lost as well. Sub-expressions
+// which fail to evaluate are kept as is, to report the error at runtime.
+//
+// Partial must be applied before type checking.
+func Partial(node *Node, known map[string]interface{}) {
+	Walk(node, &partial{known: known})
+}
+
+type partial struct {
+	known map[string]interface{}
+}
+
+func (*partial) Enter(*Node) {}
+func (p *partial) Exit(node *Node) {
+	switch n := (*node).(type) {
+	case *IdentifierNode:
+		if value, ok := p.known[n.Value]; ok {
+			Patch(node, literal(value))
+		}
+		return
+
+	case *BinaryNode:
+		switch n.Operator {
+		case "and", "&&":
+			if b, ok := n.Left.(*BoolNode); ok {
+				if b.Value {
+					*node = n.Right
+				} else {
+					*node = n.Left
+				}
+				return
+			}
+			if b, ok := n.Right.(*BoolNode); ok {
+				if b.Value {
+					*node = n.Left
+				} else {
+					*node = n.Right
+				}
+				return
+			}
+		case "or", "||":
+			if b, ok := n.Left.(*BoolNode); ok {
+				if b.Value {
+					*node = n.Left
+				} else {
+					*node = n.Right
+				}
+				return
+			}
+			if b, ok := n.Right.(*BoolNode); ok {
+				if b.Value {
+					*node = n.Right
+				} else {
+					*node = n.Left
+				}
+				return
+			}
+		}
+
+	case *ConditionalNode:
+		if b, ok := n.Cond.(*BoolNode); ok {
+			if b.Value {
+				*node = n.Exp1
+			} else {
+				*node = n.Exp2
+			}
+			return
+		}
+
+	case *ClosureNode, *PointerNode, *PairNode:
+		return // Can not be evaluated on its own.
+	}
+
+	if isLiteral(*node) || !closed(*node, 0) {
+		return
+	}
+	tree := &parser.Tree{Node: *node}
+	program, err := compiler.Compile(tree, nil)
+	if err != nil {
+		return
+	}
+	value, err := vm.Run(program, nil)
+	if err != nil {
+		return
+	}
+	Patch(node, literal(value))
+}
+
+// closed reports whether node does not depend on env,
+// depth is a number of closures node is nested in.
+func closed(node Node, depth int) bool {
+	switch n := node.(type) {
+	case *NilNode, *IntegerNode, *FloatNode, *BoolNode, *StringNode, *ConstantNode:
+		return true
+	case *UnaryNode:
+		return closed(n.Node, depth)
+	case *BinaryNode:
+		return closed(n.Left, depth) && closed(n.Right, depth)
+	case *MatchesNode:
+		return closed(n.Left, depth) && closed(n.Right, depth)
+	case *PropertyNode:
+		return closed(n.Node, depth)
+	case *IndexNode:
+		return closed(n.Node, depth) && closed(n.Index, depth)
+	case *SliceNode:
+		return closed(n.Node, depth) &&
+			(n.From == nil || closed(n.From, depth)) &&
+			(n.To == nil || closed(n.To, depth))
+	case *BuiltinNode:
+		for _, arg := range n.Arguments {
+			if !closed(arg, depth) {
+				return false
+			}
+		}
+		return true
+	case *ClosureNode:
+		return closed(n.Node, depth+1)
+	case *PointerNode:
+		return depth > 0
+	case *ConditionalNode:
+		return closed(n.Cond, depth) && closed(n.Exp1, depth) && closed(n.Exp2, depth)
+	case *ArrayNode:
+		for _, node := range n.Nodes {
+			if !closed(node, depth) {
+				return false
+			}
+		}
+		return true
+	case *MapNode:
+		for _, pair := range n.Pairs {
+			if !closed(pair, depth) {
+				return false
+			}
+		}
+		return true
+	case *PairNode:
+		return closed(n.Key, depth) && closed(n.Value, depth)
+	default:
+		// Identifiers, functions and methods depend on env.
+		return false
+	}
+}
+
+func isLiteral(node Node) bool {
+	switch node.(type) {
+	case *NilNode, *IntegerNode, *FloatNode, *BoolNode, *StringNode, *ConstantNode:
+		return true
+	}
+	return false
+}
+
+func literal(value interface{}) Node {
+	switch v := value.(type) {
+	case nil:
+		return &NilNode{}
+	case int:
+		return &IntegerNode{Value: v}
+	case float64:
+		return &FloatNode{Value: v}
+	case bool:
+		return &BoolNode{Value: v}
+	case string:
+		return &StringNode{Value: v}
+	default:
+		return &ConstantNode{Value: v}
+	}
+}
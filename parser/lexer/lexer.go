@@ -10,6 +10,7 @@ import (
 
 func Lex(source *file.Source) ([]Token, error) {
 	l := &lexer{
+		source: source,
 		input:  source.Content(),
 		tokens: make([]Token, 0),
 	}
@@ -30,6 +31,7 @@ func Lex(source *file.Source) ([]Token, error) {
 }
 
 type lexer struct {
+	source     *file.Source
 	input      string
 	state      stateFn
 	tokens     []Token
@@ -78,19 +80,30 @@ func (l *lexer) emit(t Kind) {
 }
 
 func (l *lexer) emitValue(t Kind, value string) {
+	// Tokens do not span lines.
+	end := l.startLoc
+	end.Column += utf8.RuneCountInString(l.word())
 	l.tokens = append(l.tokens, Token{
-		Location: l.startLoc,
-		Kind:     t,
-		Value:    value,
+		Location:  l.startLoc,
+		End:       end,
+		Offset:    l.source.Offset(l.startLoc),
+		EndOffset: l.source.Offset(end),
+		Kind:      t,
+		Value:     value,
 	})
 	l.start = l.end
 	l.startLoc = l.loc
 }
 
 func (l *lexer) emitEOF() {
+	end := l.prev
+	end.Column++
 	l.tokens = append(l.tokens, Token{
-		Location: l.prev, // Point to previous position for better error messages.
-		Kind:     EOF,
+		Location:  l.prev, // Point to previous position for better error messages.
+		End:       end,
+		Offset:    l.source.Offset(l.prev),
+		EndOffset: l.source.Offset(end),
+		Kind:      EOF,
 	})
 	l.start = l.end
 	l.startLoc = l.loc
@@ -145,13 +145,13 @@ func TestLex_location(t *testing.T) {
 	tokens, err := Lex(source)
 	require.NoError(t, err)
 	require.Equal(t, []Token{
-		{Location: file.Location{Line: 1, Column: 0}, Kind: Number, Value: "1"},
-		{Location: file.Location{Line: 1, Column: 1}, Kind: Operator, Value: ".."},
-		{Location: file.Location{Line: 1, Column: 3}, Kind: Number, Value: "2"},
-		{Location: file.Location{Line: 1, Column: 5}, Kind: Number, Value: "3"},
-		{Location: file.Location{Line: 1, Column: 6}, Kind: Operator, Value: ".."},
-		{Location: file.Location{Line: 1, Column: 8}, Kind: Number, Value: "4"},
-		{Location: file.Location{Line: 1, Column: 8}, Kind: EOF, Value: ""},
+		{Location: file.Location{Line: 1, Column: 0}, End: file.Location{Line: 1, Column: 1}, Offset: 0, EndOffset: 1, Kind: Number, Value: "1"},
+		{Location: file.Location{Line: 1, Column: 1}, End: file.Location{Line: 1, Column: 3}, Offset: 1, EndOffset: 3, Kind: Operator, Value: ".."},
+		{Location: file.Location{Line: 1, Column: 3}, End: file.Location{Line: 1, Column: 4}, Offset: 3, EndOffset: 4, Kind: Number, Value: "2"},
+		{Location: file.Location{Line: 1, Column: 5}, End: file.Location{Line: 1, Column: 6}, Offset: 5, EndOffset: 6, Kind: Number, Value: "3"},
+		{Location: file.Location{Line: 1, Column: 6}, End: file.Location{Line: 1, Column: 8}, Offset: 6, EndOffset: 8, Kind: Operator, Value: ".."},
+		{Location: file.Location{Line: 1, Column: 8}, End: file.Location{Line: 1, Column: 9}, Offset: 8, EndOffset: 9, Kind: Number, Value: "4"},
+		{Location: file.Location{Line: 1, Column: 8}, End: file.Location{Line: 1, Column: 9}, Offset: 8, EndOffset: 9, Kind: EOF, Value: ""},
 	}, tokens)
 }
 
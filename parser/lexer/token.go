@@ -19,8 +19,11 @@ const (
 
 type Token struct {
 	file.Location
-	Kind  Kind
-	Value string
+	End       file.Location // Location right after the token.
+	Offset    int           // Character offset of the token in source.
+	EndOffset int           // Character offset right after the token.
+	Kind      Kind
+	Value     string
 }
 
 func (t Token) String() string {
@@ -13,55 +13,10 @@ import (
 	. "github.com/byte-power/jsexpr/parser/lexer"
 )
 
-type associativity int
-
-const (
-	left associativity = iota + 1
-	right
-)
-
-type operator struct {
-	precedence    int
-	associativity associativity
-}
-
 type builtin struct {
 	arity int
 }
 
-var unaryOperators = map[string]operator{
-	"not": {50, left},
-	"!":   {50, left},
-	"-":   {500, left},
-	"+":   {500, left},
-}
-
-var binaryOperators = map[string]operator{
-	"or":         {10, left},
-	"||":         {10, left},
-	"and":        {15, left},
-	"&&":         {15, left},
-	"==":         {20, left},
-	"!=":         {20, left},
-	"<":          {20, left},
-	">":          {20, left},
-	">=":         {20, left},
-	"<=":         {20, left},
-	"not in":     {20, left},
-	"in":         {20, left},
-	"matches":    {20, left},
-	"contains":   {20, left},
-	"startsWith": {20, left},
-	"endsWith":   {20, left},
-	"..":         {25, left},
-	"+":          {30, left},
-	"-":          {30, left},
-	"*":          {60, left},
-	"/":          {60, left},
-	"%":          {60, left},
-	"**":         {70, right},
-}
-
 var builtins = map[string]builtin{
 	"len":    {1},
 	"all":    {2},
@@ -74,29 +29,89 @@ var builtins = map[string]builtin{
 }
 
 type parser struct {
+	source  *file.Source
 	tokens  []Token
 	current Token
 	pos     int
 	err     *file.Error
-	depth   int // closure call depth
+	depth   int           // closure call depth
+	end     file.Location // end of the last consumed token
+
+	diagnostics file.Diagnostics
+
+	tolerant bool     // recover from syntax errors
+	closers  []string // closing brackets of constructs being parsed
+	synced   int      // position parsing was last resumed at
 }
 
+var closing = map[string]string{"(": ")", "[": "]", "{": "}"}
+
 type Tree struct {
 	Node   Node
 	Source *file.Source
 }
 
 func Parse(input string) (*Tree, error) {
+	tree, diagnostics := Analyze(input)
+	if len(diagnostics) > 0 {
+		err := &file.Error{
+			Location: diagnostics[0].Location,
+			Range:    diagnostics[0].Range,
+			Message:  diagnostics[0].Message,
+		}
+		return nil, err.Bind(file.NewSource(input))
+	}
+	return tree, nil
+}
+
+// Analyze parses input like Parse, but returns all found problems as
+// diagnostics instead of the first error. Parsing stops at the first
+// syntax error, tree is nil if there are any problems.
+func Analyze(input string) (*Tree, file.Diagnostics) {
+	tree, diagnostics := parse(input, false)
+	if len(diagnostics) > 0 {
+		return nil, diagnostics
+	}
+	return tree, nil
+}
+
+// ParseTolerant parses input like Analyze, but recovers from syntax errors
+// and always returns a tree, which is meant for editor tools rather than
+// compilation. Parsing resumes at the next operator, comma or closing
+// bracket after an error, and invalid syntax is replaced with ErrorNode.
+func ParseTolerant(input string) (*Tree, file.Diagnostics) {
+	return parse(input, true)
+}
+
+func parse(input string, tolerant bool) (*Tree, file.Diagnostics) {
 	source := file.NewSource(input)
 
 	tokens, err := Lex(source)
 	if err != nil {
-		return nil, err
+		e := err.(*file.Error)
+		r := source.Range(e.Location, shift(e.Location, 1))
+		diagnostics := file.Diagnostics{{
+			Severity: file.SeverityError,
+			Code:     "syntax",
+			Message:  e.Message,
+			Location: e.Location,
+			Range:    r,
+		}}
+		if !tolerant {
+			return nil, diagnostics
+		}
+		node := &ErrorNode{}
+		node.SetLocation(e.Location)
+		node.SetRange(r)
+		return &Tree{Node: node, Source: source}, diagnostics
 	}
 
 	p := &parser{
-		tokens:  tokens,
-		current: tokens[0],
+		source:   source,
+		tokens:   tokens,
+		current:  tokens[0],
+		tolerant: tolerant,
+		synced:   -1,
 	}
 
 	node := p.parseExpression(0)
@@ -105,26 +120,109 @@ func Parse(input string) (*Tree, error) {
 		p.error("unexpected token %v", p.current)
 	}
 
-	if p.err != nil {
-		return nil, p.err.Bind(source)
-	}
-
 	return &Tree{
 		Node:   node,
 		Source: source,
-	}, nil
+	}, p.diagnostics
 }
 
+// error reports syntax error at current token, parsing stops
+// at the first one.
 func (p *parser) error(format string, args ...interface{}) {
 	if p.err == nil { // show first error
 		p.err = &file.Error{
 			Location: p.current.Location,
 			Message:  fmt.Sprintf(format, args...),
 		}
+		if n := len(p.diagnostics); n > 0 && p.diagnostics[n-1].Range.Start == p.current.Location {
+			return // Already reported before recovery.
+		}
+		p.report(tokenRange(p.current), "syntax", format, args...)
+	}
+}
+
+// synchronize recovers from syntax error in tolerant mode. It skips tokens
+// up to an operator, a comma or closing bracket of the innermost construct,
+// outside of nested brackets, and resumes parsing there. Closing brackets
+// of outer constructs are left for them to recover at.
+func (p *parser) synchronize() {
+	if p.err == nil || !p.tolerant {
+		return
+	}
+	// Nothing was parsed since the last recovery, so the token
+	// it stopped at must be skipped to make progress.
+	stuck := p.pos == p.synced
+	depth := 0
+	for ; !p.current.Is(EOF); p.next() {
+		switch {
+		case p.current.Is(Bracket, "(", "[", "{"):
+			depth++
+		case p.current.Is(Bracket, ")", "]", "}"):
+			if depth > 0 {
+				depth--
+				continue
+			}
+			for i := len(p.closers) - 1; i >= 0; i-- {
+				if p.closers[i] != p.current.Value {
+					continue
+				}
+				if i == len(p.closers)-1 && !stuck {
+					p.resume()
+				}
+				return
+			}
+			// Unbalanced bracket, skip it.
+		case depth == 0 && !stuck && delimiter(p.current):
+			p.resume()
+			return
+		}
+		stuck = false
 	}
 }
 
+func (p *parser) resume() {
+	p.err = nil
+	p.synced = p.pos
+}
+
+// delimiter reports whether token separates operands.
+func delimiter(token Token) bool {
+	if token.Kind != Operator {
+		return false
+	}
+	if _, ok := BinaryOperators[token.Value]; ok {
+		return true
+	}
+	return token.Is(Operator, "?", ":", ",")
+}
+
+// report reports problem which does not prevent parsing.
+func (p *parser) report(r file.Range, code string, format string, args ...interface{}) {
+	p.diagnostics = append(p.diagnostics, file.Diagnostic{
+		Severity: file.SeverityError,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Location: r.Start,
+		Range:    r,
+	})
+}
+
+func tokenRange(token Token) file.Range {
+	return file.Range{Start: token.Location, End: token.End, Offset: token.Offset, EndOffset: token.EndOffset}
+}
+
+func shift(loc file.Location, columns int) file.Location {
+	loc.Column += columns
+	return loc
+}
+
+// finish sets range of node from start to the end of the last consumed token.
+func (p *parser) finish(node Node, start file.Location) {
+	node.SetRange(p.source.Range(start, p.end))
+}
+
 func (p *parser) next() {
+	p.end = p.current.End
 	p.pos++
 	if p.pos >= len(p.tokens) {
 		p.error("unexpected end of expression")
@@ -141,22 +239,38 @@ func (p *parser) expect(kind Kind, values ...string) {
 	p.error("unexpected token %v", p.current)
 }
 
+// enter consumes opening bracket of construct, errors inside of it
+// are recovered from up to its closing bracket.
+func (p *parser) enter(bracket string) {
+	p.expect(Bracket, bracket)
+	p.closers = append(p.closers, closing[bracket])
+}
+
+// leave consumes closing bracket of construct.
+func (p *parser) leave() {
+	closer := p.closers[len(p.closers)-1]
+	p.closers = p.closers[:len(p.closers)-1]
+	p.expect(Bracket, closer)
+}
+
 // parse functions
 
 func (p *parser) parseExpression(precedence int) Node {
+	start := p.current.Location
 	nodeLeft := p.parsePrimary()
+	p.synchronize()
 
 	token := p.current
 	for token.Is(Operator) && p.err == nil {
-		if op, ok := binaryOperators[token.Value]; ok {
-			if op.precedence >= precedence {
+		if op, ok := BinaryOperators[token.Value]; ok {
+			if op.Precedence >= precedence {
 				p.next()
 
 				var nodeRight Node
-				if op.associativity == left {
-					nodeRight = p.parseExpression(op.precedence + 1)
+				if op.Associativity == LeftAssociative {
+					nodeRight = p.parseExpression(op.Precedence + 1)
 				} else {
-					nodeRight = p.parseExpression(op.precedence)
+					nodeRight = p.parseExpression(op.Precedence)
 				}
 
 				if token.Is(Operator, "matches") {
@@ -166,7 +280,7 @@ func (p *parser) parseExpression(precedence int) Node {
 					if s, ok := nodeRight.(*StringNode); ok {
 						r, err = regexp.Compile(s.Value)
 						if err != nil {
-							p.error("%v", err)
+							p.report(s.Range(), "invalid-regexp", "%v", err)
 						}
 					}
 					nodeLeft = &MatchesNode{
@@ -175,6 +289,7 @@ func (p *parser) parseExpression(precedence int) Node {
 						Right:  nodeRight,
 					}
 					nodeLeft.SetLocation(token.Location)
+					p.finish(nodeLeft, start)
 				} else {
 					nodeLeft = &BinaryNode{
 						Operator: token.Value,
@@ -182,7 +297,9 @@ func (p *parser) parseExpression(precedence int) Node {
 						Right:    nodeRight,
 					}
 					nodeLeft.SetLocation(token.Location)
+					p.finish(nodeLeft, start)
 				}
+				p.synchronize()
 				token = p.current
 				continue
 			}
@@ -191,7 +308,7 @@ func (p *parser) parseExpression(precedence int) Node {
 	}
 
 	if precedence == 0 {
-		nodeLeft = p.parseConditionalExpression(nodeLeft)
+		nodeLeft = p.parseConditionalExpression(start, nodeLeft)
 	}
 
 	return nodeLeft
@@ -201,33 +318,38 @@ func (p *parser) parsePrimary() Node {
 	token := p.current
 
 	if token.Is(Operator) {
-		if op, ok := unaryOperators[token.Value]; ok {
+		if op, ok := UnaryOperators[token.Value]; ok {
 			p.next()
-			expr := p.parseExpression(op.precedence)
+			expr := p.parseExpression(op.Precedence)
 			node := &UnaryNode{
 				Operator: token.Value,
 				Node:     expr,
 			}
 			node.SetLocation(token.Location)
-			return p.parsePostfixExpression(node)
+			p.finish(node, token.Location)
+			return p.parsePostfixExpression(token.Location, node)
 		}
 	}
 
 	if token.Is(Bracket, "(") {
-		p.next()
+		p.enter("(")
 		expr := p.parseExpression(0)
-		p.expect(Bracket, ")") // "an opened parenthesis is not properly closed"
-		return p.parsePostfixExpression(expr)
+		p.leave() // "an opened parenthesis is not properly closed"
+		return p.parsePostfixExpression(token.Location, expr)
 	}
 
 	if p.depth > 0 {
 		if token.Is(Operator, "#") || token.Is(Operator, ".") {
+			node := &PointerNode{}
+			node.SetLocation(token.Location)
 			if token.Is(Operator, "#") {
 				p.next()
+				node.SetRange(tokenRange(token))
+			} else {
+				// Pointer is implied by property accessor.
+				node.SetRange(file.Range{Start: token.Location, End: token.Location, Offset: token.Offset, EndOffset: token.Offset})
 			}
-			node := &PointerNode{}
-			node.SetLocation(token.Location)
-			return p.parsePostfixExpression(node)
+			return p.parsePostfixExpression(token.Location, node)
 		}
 	} else {
 		if token.Is(Operator, "#") || token.Is(Operator, ".") {
@@ -238,9 +360,10 @@ func (p *parser) parsePrimary() Node {
 	return p.parsePrimaryExpression()
 }
 
-func (p *parser) parseConditionalExpression(node Node) Node {
+func (p *parser) parseConditionalExpression(start file.Location, node Node) Node {
 	var expr1, expr2 Node
 	for p.current.Is(Operator, "?") && p.err == nil {
+		question := p.current
 		p.next()
 
 		if !p.current.Is(Operator, ":") {
@@ -258,6 +381,8 @@ func (p *parser) parseConditionalExpression(node Node) Node {
 			Exp1: expr1,
 			Exp2: expr2,
 		}
+		node.SetLocation(question.Location)
+		p.finish(node, start)
 	}
 	return node
 }
@@ -274,14 +399,17 @@ func (p *parser) parsePrimaryExpression() Node {
 		case "true":
 			node := &BoolNode{Value: true}
 			node.SetLocation(token.Location)
+			node.SetRange(tokenRange(token))
 			return node
 		case "false":
 			node := &BoolNode{Value: false}
 			node.SetLocation(token.Location)
+			node.SetRange(tokenRange(token))
 			return node
 		case "nil":
 			node := &NilNode{}
 			node.SetLocation(token.Location)
+			node.SetRange(tokenRange(token))
 			return node
 		default:
 			node = p.parseIdentifierExpression(token)
@@ -293,26 +421,29 @@ func (p *parser) parsePrimaryExpression() Node {
 		if strings.ContainsAny(value, ".eE") {
 			number, err := strconv.ParseFloat(value, 64)
 			if err != nil {
-				p.error("invalid float literal: %v", err)
+				p.report(tokenRange(token), "invalid-literal", "invalid float literal: %v", err)
 			}
 			node := &FloatNode{Value: number}
 			node.SetLocation(token.Location)
+			node.SetRange(tokenRange(token))
 			return node
 		} else if strings.Contains(value, "x") {
 			number, err := strconv.ParseInt(value, 0, 64)
 			if err != nil {
-				p.error("invalid hex literal: %v", err)
+				p.report(tokenRange(token), "invalid-literal", "invalid hex literal: %v", err)
 			}
 			node := &IntegerNode{Value: int(number)}
 			node.SetLocation(token.Location)
+			node.SetRange(tokenRange(token))
 			return node
 		} else {
 			number, err := strconv.ParseInt(value, 10, 64)
 			if err != nil {
-				p.error("invalid integer literal: %v", err)
+				p.report(tokenRange(token), "invalid-literal", "invalid integer literal: %v", err)
 			}
 			node := &IntegerNode{Value: int(number)}
 			node.SetLocation(token.Location)
+			node.SetRange(tokenRange(token))
 			return node
 		}
 
@@ -320,6 +451,7 @@ func (p *parser) parsePrimaryExpression() Node {
 		p.next()
 		node := &StringNode{Value: token.Value}
 		node.SetLocation(token.Location)
+		node.SetRange(tokenRange(token))
 		return node
 
 	default:
@@ -329,10 +461,13 @@ func (p *parser) parsePrimaryExpression() Node {
 			node = p.parseMapExpression(token)
 		} else {
 			p.error("unexpected token %v", token)
+			node = &ErrorNode{}
+			node.SetLocation(token.Location)
+			node.SetRange(tokenRange(token))
 		}
 	}
 
-	return p.parsePostfixExpression(node)
+	return p.parsePostfixExpression(token.Location, node)
 }
 
 func (p *parser) parseIdentifierExpression(token Token) Node {
@@ -347,7 +482,7 @@ func (p *parser) parseIdentifierExpression(token Token) Node {
 			}
 			node.SetLocation(token.Location)
 		} else if b, ok := builtins[token.Value]; ok {
-			p.expect(Bracket, "(")
+			p.enter("(")
 			// TODO: Add builtins signatures.
 			if b.arity == 1 {
 				arguments = make([]Node, 1)
@@ -358,7 +493,7 @@ func (p *parser) parseIdentifierExpression(token Token) Node {
 				p.expect(Operator, ",")
 				arguments[1] = p.parseClosure()
 			}
-			p.expect(Bracket, ")")
+			p.leave()
 
 			node = &BuiltinNode{
 				Name:      token.Value,
@@ -377,29 +512,31 @@ func (p *parser) parseIdentifierExpression(token Token) Node {
 		node = &IdentifierNode{Value: token.Value}
 		node.SetLocation(token.Location)
 	}
+	p.finish(node, token.Location)
 	return node
 }
 
 func (p *parser) parseClosure() Node {
 	token := p.current
-	p.expect(Bracket, "{")
+	p.enter("{")
 
 	p.depth++
 	node := p.parseExpression(0)
 	p.depth--
 
-	p.expect(Bracket, "}")
+	p.leave()
 	closure := &ClosureNode{
 		Node: node,
 	}
 	closure.SetLocation(token.Location)
+	p.finish(closure, token.Location)
 	return closure
 }
 
 func (p *parser) parseArrayExpression(token Token) Node {
 	nodes := make([]Node, 0)
 
-	p.expect(Bracket, "[")
+	p.enter("[")
 	for !p.current.Is(Bracket, "]") && p.err == nil {
 		if len(nodes) > 0 {
 			p.expect(Operator, ",")
@@ -411,15 +548,16 @@ func (p *parser) parseArrayExpression(token Token) Node {
 		nodes = append(nodes, node)
 	}
 end:
-	p.expect(Bracket, "]")
+	p.leave()
 
 	node := &ArrayNode{Nodes: nodes}
 	node.SetLocation(token.Location)
+	p.finish(node, token.Location)
 	return node
 }
 
 func (p *parser) parseMapExpression(token Token) Node {
-	p.expect(Bracket, "{")
+	p.enter("{")
 
 	nodes := make([]Node, 0)
 	for !p.current.Is(Bracket, "}") && p.err == nil {
@@ -434,6 +572,7 @@ func (p *parser) parseMapExpression(token Token) Node {
 		}
 
 		var key Node
+		start := p.current.Location
 		// a map key can be:
 		//  * a number
 		//  * a string
@@ -442,11 +581,15 @@ func (p *parser) parseMapExpression(token Token) Node {
 		if p.current.Is(Number) || p.current.Is(String) || p.current.Is(Identifier) {
 			key = &StringNode{Value: p.current.Value}
 			key.SetLocation(token.Location)
+			key.SetRange(tokenRange(p.current))
 			p.next()
 		} else if p.current.Is(Bracket, "(") {
 			key = p.parseExpression(0)
 		} else {
 			p.error("a map key must be a quoted string, a number, a identifier, or an expression enclosed in parentheses (unexpected token %v)", p.current)
+			key = &ErrorNode{}
+			key.SetLocation(p.current.Location)
+			key.SetRange(tokenRange(p.current))
 		}
 
 		p.expect(Operator, ":")
@@ -454,18 +597,20 @@ func (p *parser) parseMapExpression(token Token) Node {
 		node := p.parseExpression(0)
 		pair := &PairNode{Key: key, Value: node}
 		pair.SetLocation(token.Location)
+		p.finish(pair, start)
 		nodes = append(nodes, pair)
 	}
 
 end:
-	p.expect(Bracket, "}")
+	p.leave()
 
 	node := &MapNode{Pairs: nodes}
 	node.SetLocation(token.Location)
+	p.finish(node, token.Location)
 	return node
 }
 
-func (p *parser) parsePostfixExpression(node Node) Node {
+func (p *parser) parsePostfixExpression(start file.Location, node Node) Node {
 	token := p.current
 	for (token.Is(Operator) || token.Is(Bracket)) && p.err == nil {
 		if token.Value == "." {
@@ -478,9 +623,9 @@ func (p *parser) parsePostfixExpression(node Node) Node {
 				// Operators like "not" and "matches" are valid methods or property names.
 				(token.Kind != Operator || !isValidIdentifier(token.Value)) {
 				p.error("expected name")
-			}
-
-			if p.current.Is(Bracket, "(") {
+				node = &ErrorNode{Node: node}
+				node.SetLocation(token.Location)
+			} else if p.current.Is(Bracket, "(") {
 				arguments := p.parseArguments()
 				node = &MethodNode{
 					Node:      node,
@@ -497,7 +642,7 @@ func (p *parser) parsePostfixExpression(node Node) Node {
 			}
 
 		} else if token.Value == "[" {
-			p.next()
+			p.enter("[")
 			var from, to Node
 
 			if p.current.Is(Operator, ":") { // slice without from [:1]
@@ -512,7 +657,7 @@ func (p *parser) parsePostfixExpression(node Node) Node {
 					To:   to,
 				}
 				node.SetLocation(token.Location)
-				p.expect(Bracket, "]")
+				p.leave()
 
 			} else {
 
@@ -531,7 +676,7 @@ func (p *parser) parsePostfixExpression(node Node) Node {
 						To:   to,
 					}
 					node.SetLocation(token.Location)
-					p.expect(Bracket, "]")
+					p.leave()
 
 				} else {
 					// Slice operator [:] was not found, it should by just index node.
@@ -541,7 +686,7 @@ func (p *parser) parsePostfixExpression(node Node) Node {
 						Index: from,
 					}
 					node.SetLocation(token.Location)
-					p.expect(Bracket, "]")
+					p.leave()
 				}
 			}
 
@@ -549,6 +694,7 @@ func (p *parser) parsePostfixExpression(node Node) Node {
 			break
 		}
 
+		p.finish(node, start)
 		token = p.current
 	}
 	return node
@@ -571,7 +717,7 @@ func isValidIdentifier(str string) bool {
 }
 
 func (p *parser) parseArguments() []Node {
-	p.expect(Bracket, "(")
+	p.enter("(")
 	nodes := make([]Node, 0)
 	for !p.current.Is(Bracket, ")") && p.err == nil {
 		if len(nodes) > 0 {
@@ -580,7 +726,7 @@ func (p *parser) parseArguments() []Node {
 		node := p.parseExpression(0)
 		nodes = append(nodes, node)
 	}
-	p.expect(Bracket, ")")
+	p.leave()
 
 	return nodes
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/file"
 	"github.com/byte-power/jsexpr/parser"
 	"github.com/stretchr/testify/assert"
 )
@@ -273,9 +274,9 @@ a map key must be a quoted string, a number, a identifier, or an expression encl
  | .^
 
 a matches 'a:)b'
-error parsing regexp: unexpected ): ` + "`a:)b`" + ` (1:16)
+error parsing regexp: unexpected ): ` + "`a:)b`" + ` (1:11)
  | a matches 'a:)b'
- | ...............^
+ | ..........^^^^^^
 
 foo({.bar})
 a map key must be a quoted string, a number, a identifier, or an expression enclosed in parentheses (unexpected token Operator(".")) (1:6)
@@ -324,6 +325,85 @@ func TestParse_error(t *testing.T) {
 	}
 }
 
+func TestParseTolerant(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ast.Node
+		errors   []string
+	}{
+		{
+			`user.`,
+			&ast.ErrorNode{Node: &ast.IdentifierNode{Value: "user"}},
+			[]string{"unexpected end of expression"},
+		},
+		{
+			`a + * b`,
+			&ast.BinaryNode{
+				Operator: "+",
+				Left:     &ast.IdentifierNode{Value: "a"},
+				Right:    &ast.BinaryNode{Operator: "*", Left: &ast.ErrorNode{}, Right: &ast.IdentifierNode{Value: "b"}},
+			},
+			[]string{`unexpected token Operator("*")`},
+		},
+		{
+			`foo(1, , bar.)`,
+			&ast.FunctionNode{
+				Name: "foo",
+				Arguments: []ast.Node{
+					&ast.IntegerNode{Value: 1},
+					&ast.ErrorNode{},
+					&ast.ErrorNode{Node: &ast.IdentifierNode{Value: "bar"}},
+				},
+			},
+			[]string{`unexpected token Operator(",")`, "expected name"},
+		},
+		{
+			`[(1 2), {a: }]`,
+			&ast.ArrayNode{Nodes: []ast.Node{
+				&ast.IntegerNode{Value: 1},
+				&ast.MapNode{Pairs: []ast.Node{
+					&ast.PairNode{Key: &ast.StringNode{Value: "a"}, Value: &ast.ErrorNode{}},
+				}},
+			}},
+			[]string{`unexpected token Number("2")`, `unexpected token Bracket("}")`},
+		},
+		{
+			`a + ) + b`,
+			&ast.BinaryNode{
+				Operator: "+",
+				Left:     &ast.BinaryNode{Operator: "+", Left: &ast.IdentifierNode{Value: "a"}, Right: &ast.ErrorNode{}},
+				Right:    &ast.IdentifierNode{Value: "b"},
+			},
+			[]string{`unexpected token Bracket(")")`},
+		},
+		{
+			`"abc`,
+			&ast.ErrorNode{},
+			[]string{"literal not terminated"},
+		},
+	}
+
+	for _, test := range tests {
+		tree, diagnostics := parser.ParseTolerant(test.input)
+		assert.Equal(t, ast.Dump(test.expected), ast.Dump(tree.Node), test.input)
+
+		var errors []string
+		for _, d := range diagnostics {
+			errors = append(errors, d.Message)
+		}
+		assert.Equal(t, test.errors, errors, test.input)
+	}
+}
+
+func TestParseTolerant_valid(t *testing.T) {
+	tree, diagnostics := parser.ParseTolerant(`all(items, {.age > 18}) ? [1, 2] : {a: b}`)
+	assert.Empty(t, diagnostics)
+
+	expected, err := parser.Parse(`all(items, {.age > 18}) ? [1, 2] : {a: b}`)
+	assert.NoError(t, err)
+	assert.Equal(t, ast.Dump(expected.Node), ast.Dump(tree.Node))
+}
+
 func TestParseJSBuiltinFuncs(t *testing.T) {
 	type test struct {
 		input string
@@ -346,3 +426,25 @@ func TestParseJSBuiltinFuncs(t *testing.T) {
 		assert.Nil(t, err)
 	}
 }
+
+func TestParse_range(t *testing.T) {
+	tree, err := parser.Parse(`(a + b) * c.d[0] ? 'x' : [1, 2]`)
+	assert.NoError(t, err)
+
+	source := file.NewSource(`(a + b) * c.d[0] ? 'x' : [1, 2]`)
+	text := func(node ast.Node) string {
+		r := node.Range()
+		line, _ := source.Snippet(r.Start.Line)
+		return string([]rune(line)[r.Start.Column:r.End.Column])
+	}
+
+	cond := tree.Node.(*ast.ConditionalNode)
+	assert.Equal(t, `(a + b) * c.d[0] ? 'x' : [1, 2]`, text(cond))
+	mul := cond.Cond.(*ast.BinaryNode)
+	assert.Equal(t, `(a + b) * c.d[0]`, text(mul))
+	assert.Equal(t, `a + b`, text(mul.Left))
+	assert.Equal(t, `c.d[0]`, text(mul.Right))
+	assert.Equal(t, `c.d`, text(mul.Right.(*ast.IndexNode).Node))
+	assert.Equal(t, `'x'`, text(cond.Exp1))
+	assert.Equal(t, `[1, 2]`, text(cond.Exp2))
+}
@@ -0,0 +1,84 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// BatchOptions configures RunBatch.
+type BatchOptions struct {
+	// Workers is a number of goroutines evaluating envs, each with its own VM.
+	// Zero or one evaluates envs sequentially in the calling goroutine.
+	Workers int
+}
+
+// batchChunk is a number of envs a worker takes at once.
+const batchChunk = 64
+
+// RunBatch evaluates program over every element of envs, which must be
+// []interface{} or any other slice or array. VMs are reused between envs.
+// Outputs and errors are returned in the order of envs, errs[i] is nil
+// if i-th env was evaluated successfully.
+func RunBatch(program *Program, envs interface{}, opts BatchOptions) (out []interface{}, errs []error, err error) {
+	if program == nil {
+		return nil, nil, fmt.Errorf("program is nil")
+	}
+
+	var at func(i int) interface{}
+	var size int
+	if list, ok := envs.([]interface{}); ok {
+		size = len(list)
+		at = func(i int) interface{} { return list[i] }
+	} else {
+		v := reflect.ValueOf(envs)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, nil, fmt.Errorf("envs must be a slice, got %T", envs)
+		}
+		size = v.Len()
+		at = func(i int) interface{} { return v.Index(i).Interface() }
+	}
+
+	out = make([]interface{}, size)
+	errs = make([]error, size)
+
+	workers := opts.Workers
+	if workers > (size+batchChunk-1)/batchChunk {
+		workers = (size + batchChunk - 1) / batchChunk
+	}
+	if workers <= 1 {
+		vm := &VM{}
+		vm.Init(program, nil)
+		for i := 0; i < size; i++ {
+			out[i], errs[i] = vm.Run(program, at(i))
+		}
+		return out, errs, nil
+	}
+
+	var next int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			vm := &VM{}
+			vm.Init(program, nil)
+			for {
+				start := int(atomic.AddInt64(&next, batchChunk)) - batchChunk
+				if start >= size {
+					return
+				}
+				end := start + batchChunk
+				if end > size {
+					end = size
+				}
+				for i := start; i < end; i++ {
+					out[i], errs[i] = vm.Run(program, at(i))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return out, errs, nil
+}
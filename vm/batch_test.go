@@ -0,0 +1,82 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/byte-power/jsexpr/compiler"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/byte-power/jsexpr/vm"
+	"github.com/stretchr/testify/require"
+)
+
+type batchUser struct {
+	Name    string `jsexpr:"name"`
+	Age     int    `jsexpr:"age"`
+	Address *struct {
+		City string `jsexpr:"city"`
+	} `jsexpr:"address"`
+}
+
+func TestRunBatch(t *testing.T) {
+	tree, err := parser.Parse(`name + " " + string(age / (age - 30))`)
+	require.NoError(t, err)
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+
+	envs := make([]map[string]interface{}, 1000)
+	for i := range envs {
+		envs[i] = map[string]interface{}{
+			"name":   "user",
+			"age":    i % 40,
+			"string": func(i int) string { return "ok" },
+		}
+	}
+
+	for _, workers := range []int{0, 1, 3, 16} {
+		out, errs, err := vm.RunBatch(program, envs, vm.BatchOptions{Workers: workers})
+		require.NoError(t, err)
+		require.Len(t, out, len(envs))
+		require.Len(t, errs, len(envs))
+		for i := range envs {
+			if i%40 == 30 {
+				require.Error(t, errs[i], "%v", i)
+				require.Contains(t, errs[i].Error(), "integer divide by zero")
+				require.Nil(t, out[i])
+			} else {
+				require.NoError(t, errs[i], "%v", i)
+				require.Equal(t, "user ok", out[i])
+			}
+		}
+	}
+}
+
+func TestRunBatch_structs(t *testing.T) {
+	tree, err := parser.Parse(`address.city`)
+	require.NoError(t, err)
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+
+	a := batchUser{Name: "a"}
+	a.Address = &struct {
+		City string `jsexpr:"city"`
+	}{City: "Berlin"}
+	b := batchUser{Name: "b"}
+	b.Address = &struct {
+		City string `jsexpr:"city"`
+	}{City: "Paris"}
+
+	out, errs, err := vm.RunBatch(program, []interface{}{a, &b}, vm.BatchOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"Berlin", "Paris"}, out)
+	require.Equal(t, []error{nil, nil}, errs)
+}
+
+func TestRunBatch_not_slice(t *testing.T) {
+	tree, err := parser.Parse(`1`)
+	require.NoError(t, err)
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+
+	_, _, err = vm.RunBatch(program, 42, vm.BatchOptions{})
+	require.EqualError(t, err, "envs must be a slice, got int")
+}
@@ -0,0 +1,490 @@
+package vm
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"regexp"
+	"sort"
+
+	"github.com/byte-power/jsexpr/file"
+)
+
+// BinaryVersion is a version of binary encoding of programs. It is bumped
+// when encoding changes, programs of other versions are rejected.
+const BinaryVersion = 1
+
+var binaryMagic = [4]byte{'J', 'S', 'X', 'P'}
+
+var (
+	_ encoding.BinaryMarshaler   = (*Program)(nil)
+	_ encoding.BinaryUnmarshaler = (*Program)(nil)
+)
+
+// Tags of constants, new tags must be added to the end.
+const (
+	tagNil byte = iota
+	tagFalse
+	tagTrue
+	tagInt
+	tagInt8
+	tagInt16
+	tagInt32
+	tagInt64
+	tagUint
+	tagUint8
+	tagUint16
+	tagUint32
+	tagUint64
+	tagFloat32
+	tagFloat64
+	tagString
+	tagRegexp
+	tagCall
+	tagField
+	tagArray
+	tagMap
+	tagInts
+	tagStrings
+	tagIntSet
+	tagStringSet
+)
+
+const (
+	flagWide   = 1 << 0
+	flagSource = 1 << 1
+)
+
+// errTruncated is raised when decoder reaches the end of data.
+var errTruncated = errors.New("unexpected end of data")
+
+// MarshalBinary encodes program with a version header, typed constants and
+// a checksum. Spans, Branches, Clock, Rand and call options are not encoded,
+// so decoded programs can't be run in three-valued mode. Fields resolved by
+// OpFetchField are fetched by names after decoding.
+func (program *Program) MarshalBinary() ([]byte, error) {
+	e := &encoder{}
+	e.buf = append(e.buf, binaryMagic[:]...)
+	e.uvarint(BinaryVersion)
+	// Opcodes are renumbered when new ones are added.
+	e.byte(OpEnd)
+
+	var flags byte
+	if program.Wide {
+		flags |= flagWide
+	}
+	if program.Source != nil {
+		flags |= flagSource
+	}
+	e.byte(flags)
+	if program.Source != nil {
+		e.string(program.Source.Content())
+	}
+
+	e.bytes(program.Bytecode)
+
+	e.uvarint(uint64(len(program.Constants)))
+	for _, c := range program.Constants {
+		if err := e.constant(c); err != nil {
+			return nil, err
+		}
+	}
+
+	ips := make([]int, 0, len(program.Locations))
+	for ip := range program.Locations {
+		ips = append(ips, ip)
+	}
+	sort.Ints(ips)
+	e.uvarint(uint64(len(ips)))
+	for _, ip := range ips {
+		loc := program.Locations[ip]
+		e.uvarint(uint64(ip))
+		e.varint(int64(loc.Line))
+		e.varint(int64(loc.Column))
+	}
+
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(e.buf))
+	return append(e.buf, sum[:]...), nil
+}
+
+// UnmarshalBinary decodes program encoded by MarshalBinary and verifies it.
+func (program *Program) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < len(binaryMagic)+4 || !bytes.Equal(data[:len(binaryMagic)], binaryMagic[:]) {
+		return fmt.Errorf("invalid program: bad header")
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return fmt.Errorf("invalid program: checksum mismatch")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid program: %v", r)
+		}
+	}()
+
+	d := &decoder{data: body[len(binaryMagic):]}
+	if version := d.uvarint(); version != BinaryVersion {
+		return fmt.Errorf("invalid program: unsupported version %v, expected %v", version, BinaryVersion)
+	}
+	if end := d.byte(); end != OpEnd {
+		return fmt.Errorf("invalid program: compiled with incompatible opcodes")
+	}
+
+	p := Program{}
+	flags := d.byte()
+	p.Wide = flags&flagWide != 0
+	if flags&flagSource != 0 {
+		p.Source = file.NewSource(d.string())
+	}
+
+	p.Bytecode = d.bytes()
+
+	p.Constants = make([]interface{}, d.size())
+	for i := range p.Constants {
+		p.Constants[i] = d.constant()
+	}
+
+	n := d.size()
+	p.Locations = make(map[int]file.Location, n)
+	for i := 0; i < n; i++ {
+		ip := int(d.uvarint())
+		p.Locations[ip] = file.Location{Line: int(d.varint()), Column: int(d.varint())}
+	}
+
+	if len(d.data) > 0 {
+		return fmt.Errorf("invalid program: %v trailing bytes", len(d.data))
+	}
+	if err := Verify(&p); err != nil {
+		return err
+	}
+	*program = p
+	return nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) byte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) uvarint(u uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], u)]...)
+}
+
+func (e *encoder) varint(i int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], i)]...)
+}
+
+func (e *encoder) fixed(u uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], u)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) constant(c interface{}) error {
+	switch v := c.(type) {
+	case nil:
+		e.byte(tagNil)
+	case bool:
+		if v {
+			e.byte(tagTrue)
+		} else {
+			e.byte(tagFalse)
+		}
+	case int:
+		e.byte(tagInt)
+		e.varint(int64(v))
+	case int8:
+		e.byte(tagInt8)
+		e.varint(int64(v))
+	case int16:
+		e.byte(tagInt16)
+		e.varint(int64(v))
+	case int32:
+		e.byte(tagInt32)
+		e.varint(int64(v))
+	case int64:
+		e.byte(tagInt64)
+		e.varint(v)
+	case uint:
+		e.byte(tagUint)
+		e.uvarint(uint64(v))
+	case uint8:
+		e.byte(tagUint8)
+		e.uvarint(uint64(v))
+	case uint16:
+		e.byte(tagUint16)
+		e.uvarint(uint64(v))
+	case uint32:
+		e.byte(tagUint32)
+		e.uvarint(uint64(v))
+	case uint64:
+		e.byte(tagUint64)
+		e.uvarint(v)
+	case float32:
+		e.byte(tagFloat32)
+		e.fixed(uint64(math.Float32bits(v)))
+	case float64:
+		e.byte(tagFloat64)
+		e.fixed(math.Float64bits(v))
+	case string:
+		e.byte(tagString)
+		e.string(v)
+	case *regexp.Regexp:
+		e.byte(tagRegexp)
+		e.string(v.String())
+	case Call:
+		e.byte(tagCall)
+		e.string(v.Name)
+		e.uvarint(uint64(v.Size))
+	case Field:
+		e.byte(tagField)
+		e.uvarint(uint64(len(v.Names)))
+		for _, name := range v.Names {
+			e.string(name)
+		}
+		e.uvarint(uint64(len(v.Path)))
+		for _, i := range v.Path {
+			e.uvarint(uint64(i))
+		}
+	case []interface{}:
+		e.byte(tagArray)
+		e.uvarint(uint64(len(v)))
+		for _, item := range v {
+			if err := e.constant(item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		e.byte(tagMap)
+		e.uvarint(uint64(len(v)))
+		for _, key := range sortedKeys(v) {
+			e.string(key)
+			if err := e.constant(v[key]); err != nil {
+				return err
+			}
+		}
+	case []int:
+		e.byte(tagInts)
+		e.uvarint(uint64(len(v)))
+		for _, i := range v {
+			e.varint(int64(i))
+		}
+	case []string:
+		e.byte(tagStrings)
+		e.uvarint(uint64(len(v)))
+		for _, s := range v {
+			e.string(s)
+		}
+	case map[int]struct{}:
+		keys := make([]int, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Ints(keys)
+		e.byte(tagIntSet)
+		e.uvarint(uint64(len(keys)))
+		for _, key := range keys {
+			e.varint(int64(key))
+		}
+	case map[string]struct{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		e.byte(tagStringSet)
+		e.uvarint(uint64(len(keys)))
+		for _, key := range keys {
+			e.string(key)
+		}
+	default:
+		return fmt.Errorf("cannot encode constant of type %T", c)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) byte() byte {
+	if len(d.data) == 0 {
+		panic(errTruncated)
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	u, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		panic(errTruncated)
+	}
+	d.data = d.data[n:]
+	return u
+}
+
+func (d *decoder) varint() int64 {
+	i, n := binary.Varint(d.data)
+	if n <= 0 {
+		panic(errTruncated)
+	}
+	d.data = d.data[n:]
+	return i
+}
+
+func (d *decoder) fixed() uint64 {
+	if len(d.data) < 8 {
+		panic(errTruncated)
+	}
+	u := binary.LittleEndian.Uint64(d.data)
+	d.data = d.data[8:]
+	return u
+}
+
+// size reads length of a sequence, which can't be longer than the rest of data.
+func (d *decoder) size() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		panic(errTruncated)
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.size()
+	b := append([]byte(nil), d.data[:n]...)
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) string() string {
+	n := d.size()
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s
+}
+
+func (d *decoder) constant() interface{} {
+	switch tag := d.byte(); tag {
+	case tagNil:
+		return nil
+	case tagFalse:
+		return false
+	case tagTrue:
+		return true
+	case tagInt:
+		return int(d.varint())
+	case tagInt8:
+		return int8(d.varint())
+	case tagInt16:
+		return int16(d.varint())
+	case tagInt32:
+		return int32(d.varint())
+	case tagInt64:
+		return d.varint()
+	case tagUint:
+		return uint(d.uvarint())
+	case tagUint8:
+		return uint8(d.uvarint())
+	case tagUint16:
+		return uint16(d.uvarint())
+	case tagUint32:
+		return uint32(d.uvarint())
+	case tagUint64:
+		return d.uvarint()
+	case tagFloat32:
+		return math.Float32frombits(uint32(d.fixed()))
+	case tagFloat64:
+		return math.Float64frombits(d.fixed())
+	case tagString:
+		return d.string()
+	case tagRegexp:
+		return regexp.MustCompile(d.string())
+	case tagCall:
+		return Call{Name: d.string(), Size: int(d.uvarint())}
+	case tagField:
+		field := Field{Names: make([]string, d.size())}
+		for i := range field.Names {
+			field.Names[i] = d.string()
+		}
+		field.Path = make([]int, d.size())
+		for i := range field.Path {
+			field.Path[i] = int(d.uvarint())
+		}
+		return field
+	case tagArray:
+		array := make([]interface{}, d.size())
+		for i := range array {
+			array[i] = d.constant()
+		}
+		return array
+	case tagMap:
+		n := d.size()
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			key := d.string()
+			m[key] = d.constant()
+		}
+		return m
+	case tagInts:
+		ints := make([]int, d.size())
+		for i := range ints {
+			ints[i] = int(d.varint())
+		}
+		return ints
+	case tagStrings:
+		strs := make([]string, d.size())
+		for i := range strs {
+			strs[i] = d.string()
+		}
+		return strs
+	case tagIntSet:
+		n := d.size()
+		set := make(map[int]struct{}, n)
+		for i := 0; i < n; i++ {
+			set[int(d.varint())] = struct{}{}
+		}
+		return set
+	case tagStringSet:
+		n := d.size()
+		set := make(map[string]struct{}, n)
+		for i := 0; i < n; i++ {
+			set[d.string()] = struct{}{}
+		}
+		return set
+	default:
+		panic(fmt.Sprintf("unknown constant tag %v", tag))
+	}
+}
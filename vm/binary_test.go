@@ -0,0 +1,110 @@
+package vm_test
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/byte-power/jsexpr/checker"
+	"github.com/byte-power/jsexpr/compiler"
+	"github.com/byte-power/jsexpr/conf"
+	"github.com/byte-power/jsexpr/optimizer"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/byte-power/jsexpr/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgram_MarshalBinary(t *testing.T) {
+	type User struct {
+		Name  string  `jsexpr:"name"`
+		Age   int     `jsexpr:"age"`
+		Score float64 `jsexpr:"score"`
+	}
+	type Env struct {
+		User User              `jsexpr:"user"`
+		Tags []string          `jsexpr:"tags"`
+		Meta map[string]string `jsexpr:"meta"`
+	}
+	env := Env{
+		User: User{Name: "Ann", Age: 42, Score: 0.5},
+		Tags: []string{"a", "b"},
+		Meta: map[string]string{"k": "v"},
+	}
+
+	tests := []string{
+		`user.age in [1, 2, 42]`,
+		`user.name in ["Ann", "Bob"]`,
+		`user.name matches "^A.+"`,
+		`user.score * 2.5 > 1.0 ? 1..3 : [1]`,
+		`all(tags, {# in ["a", "b"]}) and meta.k == "v"`,
+		`len(user.name + "!") == 4 && -1 < 0 && nil == nil`,
+		`["x", 1, 2.5, true]`,
+	}
+
+	for _, input := range tests {
+		tree, err := parser.Parse(input)
+		require.NoError(t, err, input)
+
+		config := conf.New(Env{})
+		_, err = checker.Check(tree, config)
+		require.NoError(t, err, input)
+		require.NoError(t, optimizer.Optimize(&tree.Node, config), input)
+
+		program, err := compiler.Compile(tree, config)
+		require.NoError(t, err, input)
+
+		data, err := program.MarshalBinary()
+		require.NoError(t, err, input)
+
+		decoded := &vm.Program{}
+		require.NoError(t, decoded.UnmarshalBinary(data), input)
+		require.Equal(t, program.Bytecode, decoded.Bytecode, input)
+		require.Equal(t, program.Locations, decoded.Locations, input)
+		require.Equal(t, program.Source.Content(), decoded.Source.Content(), input)
+
+		expected, err := vm.Run(program, env)
+		require.NoError(t, err, input)
+		out, err := vm.Run(decoded, env)
+		require.NoError(t, err, input)
+		require.Equal(t, expected, out, input)
+
+		again, err := decoded.MarshalBinary()
+		require.NoError(t, err, input)
+		require.Equal(t, data, again, input)
+	}
+}
+
+func TestProgram_UnmarshalBinary_errors(t *testing.T) {
+	tree, err := parser.Parse(`a + 1`)
+	require.NoError(t, err)
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+	data, err := program.MarshalBinary()
+	require.NoError(t, err)
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(corrupted)/2] ^= 0xFF
+
+	versioned := append([]byte(nil), data...)
+	versioned[4] = vm.BinaryVersion + 1
+	binary.LittleEndian.PutUint32(versioned[len(versioned)-4:], crc32.ChecksumIEEE(versioned[:len(versioned)-4]))
+
+	tests := []struct {
+		data []byte
+		err  string
+	}{
+		{nil, "bad header"},
+		{[]byte("not a program"), "bad header"},
+		{corrupted, "checksum mismatch"},
+		{versioned, "unsupported version 2, expected 1"},
+		{data[:len(data)-1], "checksum mismatch"},
+	}
+	for _, test := range tests {
+		err := (&vm.Program{}).UnmarshalBinary(test.data)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), test.err)
+	}
+
+	_, err = (&vm.Program{Constants: []interface{}{struct{}{}}}).MarshalBinary()
+	require.EqualError(t, err, "cannot encode constant of type struct {}")
+}
@@ -0,0 +1,266 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/file"
+)
+
+// Coverage records outcomes of conditions ("and", "or", ternary and closure
+// predicates) of a program across many runs. It is safe to call Run concurrently.
+type Coverage struct {
+	program *Program
+
+	mu     sync.Mutex
+	runs   int
+	counts map[int]*[2]int // Number of false and true outcomes by jump position.
+}
+
+func NewCoverage(program *Program) (*Coverage, error) {
+	if program == nil {
+		return nil, fmt.Errorf("program is nil")
+	}
+	if len(program.Spans) == 0 {
+		return nil, fmt.Errorf("program has no node spans, it should be compiled from source")
+	}
+	return &Coverage{
+		program: program,
+		counts:  make(map[int]*[2]int),
+	}, nil
+}
+
+// Run evaluates program with env and records taken branches.
+func (c *Coverage) Run(env interface{}) (interface{}, error) {
+	t := &coverageTracer{
+		branches: c.program.Branches,
+		counts:   make(map[int]*[2]int),
+	}
+	t.vm = &VM{}
+	t.vm.Init(c.program, env)
+	t.vm.SetTracer(t)
+
+	out, err := t.vm.Run(c.program, env)
+
+	c.mu.Lock()
+	c.runs++
+	for ip, n := range t.counts {
+		if _, ok := c.counts[ip]; !ok {
+			c.counts[ip] = &[2]int{}
+		}
+		c.counts[ip][0] += n[0]
+		c.counts[ip][1] += n[1]
+	}
+	c.mu.Unlock()
+
+	return out, err
+}
+
+type coverageTracer struct {
+	vm       *VM
+	branches map[int]Branch
+	counts   map[int]*[2]int
+}
+
+func (t *coverageTracer) RunStart(*Program) {}
+
+func (t *coverageTracer) RunEnd(*Program, interface{}, error) {}
+
+func (t *coverageTracer) Opcode(ip int, _ byte) {
+	branch, ok := t.branches[ip]
+	if !ok {
+		return
+	}
+	stack := t.vm.Stack()
+	if len(stack) == 0 {
+		return
+	}
+	value, ok := stack[len(stack)-1].(bool)
+	if !ok {
+		return // Let vm report the error.
+	}
+	if branch.Negate {
+		value = !value
+	}
+	n, ok := t.counts[ip]
+	if !ok {
+		n = &[2]int{}
+		t.counts[ip] = n
+	}
+	if value {
+		n[1]++
+	} else {
+		n[0]++
+	}
+}
+
+func (t *coverageTracer) Call(string, bool, time.Duration) {}
+
+func (t *coverageTracer) Fetch(string, bool, time.Duration) {}
+
+// CoverageReport describes outcomes of every condition of a program.
+type CoverageReport struct {
+	Runs     int
+	Branches []BranchCoverage // In source order.
+}
+
+// BranchCoverage holds number of times condition was true and false.
+type BranchCoverage struct {
+	Kind  string   // One of "and", "or", "ternary" or "predicate".
+	Cond  ast.Node // Tested condition.
+	Owner ast.Node // Node which branches on the condition.
+	True  int
+	False int
+
+	source *file.Source
+	then   ast.Node // Node evaluated if condition is true.
+	other  ast.Node // Node evaluated if condition is false.
+}
+
+// Report returns coverage collected so far.
+func (c *Coverage) Report() *CoverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ips := make([]int, 0, len(c.program.Branches))
+	for ip := range c.program.Branches {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return c.program.Branches[ips[i]].Cond < c.program.Branches[ips[j]].Cond
+	})
+
+	report := &CoverageReport{Runs: c.runs}
+	for _, ip := range ips {
+		span := c.program.Spans[c.program.Branches[ip].Cond]
+		b := BranchCoverage{
+			Cond:   span.Node,
+			Owner:  span.Node,
+			source: c.program.Source,
+		}
+		if span.Parent >= 0 {
+			b.Owner = c.program.Spans[span.Parent].Node
+		}
+		if n, ok := c.counts[ip]; ok {
+			b.False, b.True = n[0], n[1]
+		}
+		switch o := b.Owner.(type) {
+		case *ast.BinaryNode:
+			switch o.Operator {
+			case "and", "&&":
+				b.Kind = "and"
+				b.then = o.Right
+			case "or", "||":
+				b.Kind = "or"
+				b.other = o.Right
+			}
+		case *ast.ConditionalNode:
+			b.Kind = "ternary"
+			b.then, b.other = o.Exp1, o.Exp2
+		case *ast.BuiltinNode:
+			b.Kind = "predicate"
+		}
+		report.Branches = append(report.Branches, b)
+	}
+	return report
+}
+
+// Covered returns number of outcomes (true and false for every condition) which were seen.
+func (r *CoverageReport) Covered() int {
+	n := 0
+	for _, b := range r.Branches {
+		if b.True > 0 {
+			n++
+		}
+		if b.False > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Total returns number of all possible outcomes.
+func (r *CoverageReport) Total() int {
+	return 2 * len(r.Branches)
+}
+
+// Uncovered returns conditions which were never true or never false.
+func (r *CoverageReport) Uncovered() []BranchCoverage {
+	var out []BranchCoverage
+	for _, b := range r.Branches {
+		if b.True == 0 || b.False == 0 {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// String renders uncovered conditions with source snippets.
+func (r *CoverageReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d branches covered in %d runs\n", r.Covered(), r.Total(), r.Runs)
+	for _, branch := range r.Uncovered() {
+		for _, msg := range branch.Messages() {
+			b.WriteString(msg)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// Messages describes every missed outcome of the condition with a source snippet.
+func (b BranchCoverage) Messages() []string {
+	var out []string
+	if b.True == 0 {
+		out = append(out, b.message(true))
+	}
+	if b.False == 0 {
+		out = append(out, b.message(false))
+	}
+	return out
+}
+
+func (b BranchCoverage) message(outcome bool) string {
+	var msg string
+	location := b.Cond.Location()
+	switch b.Kind {
+	case "and":
+		if outcome {
+			msg = "right side of and is never evaluated"
+			location = b.then.Location()
+		} else {
+			msg = "left side of and is never false"
+		}
+	case "or":
+		if outcome {
+			msg = "left side of or is never true"
+		} else {
+			msg = "right side of or is never evaluated"
+			location = b.other.Location()
+		}
+	case "ternary":
+		if outcome {
+			msg = "then branch of ternary is never taken"
+			location = b.then.Location()
+		} else {
+			msg = "else branch of ternary is never taken"
+			location = b.other.Location()
+		}
+	case "predicate":
+		msg = fmt.Sprintf("predicate of %v never returns %v", b.Owner.(*ast.BuiltinNode).Name, outcome)
+	default:
+		msg = fmt.Sprintf("condition is never %v", outcome)
+	}
+	if location.Empty() {
+		location = b.Owner.Location()
+	}
+	err := &file.Error{Location: location, Message: msg}
+	if b.source != nil {
+		err = err.Bind(b.source)
+	}
+	return err.Error()
+}
@@ -0,0 +1,244 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/byte-power/jsexpr/file"
+)
+
+type debugMode int
+
+const (
+	debugContinue debugMode = iota
+	debugStep
+	debugStepOver
+)
+
+// Debugger runs program in a separate goroutine and pauses it on breakpoints
+// or after steps. Execution control methods block until program is paused
+// again or finished. While program is paused it is safe to inspect stack and
+// scopes. Debugger must be controlled from a single goroutine.
+type Debugger struct {
+	program *Program
+	env     interface{}
+	vm      *VM
+
+	mu          sync.Mutex
+	breakpoints map[int]bool
+
+	mode      debugMode
+	overLoc   file.Location
+	overDepth int
+	aborted   bool
+
+	started bool
+	paused  chan int
+	resume  chan struct{}
+	done    chan struct{}
+	ip      int
+	out     interface{}
+	err     error
+}
+
+func NewDebugger(program *Program, env interface{}) *Debugger {
+	d := &Debugger{
+		program:     program,
+		env:         env,
+		breakpoints: make(map[int]bool),
+		paused:      make(chan int),
+		resume:      make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	d.vm = &VM{}
+	d.vm.Init(program, env)
+	d.vm.SetTracer(d)
+	return d
+}
+
+// Break sets breakpoint on opcode at ip.
+func (d *Debugger) Break(ip int) error {
+	if _, ok := d.program.Locations[ip]; !ok {
+		return fmt.Errorf("no opcode at %v", ip)
+	}
+	d.mu.Lock()
+	d.breakpoints[ip] = true
+	d.mu.Unlock()
+	return nil
+}
+
+// BreakAt sets breakpoint on first opcode generated for given source position.
+// Line is 1-based and column is 0-based as in file.Location. If column is
+// negative, first opcode of the line is used. Position of breakpoint is returned.
+func (d *Debugger) BreakAt(line, column int) (int, error) {
+	ip := -1
+	for pos, loc := range d.program.Locations {
+		if loc.Line != line || (column >= 0 && loc.Column != column) {
+			continue
+		}
+		if ip == -1 || pos < ip {
+			ip = pos
+		}
+	}
+	if ip == -1 {
+		if column >= 0 {
+			return -1, fmt.Errorf("no code at %v:%v", line, column+1)
+		}
+		return -1, fmt.Errorf("no code at line %v", line)
+	}
+	return ip, d.Break(ip)
+}
+
+// Clear removes breakpoint at ip.
+func (d *Debugger) Clear(ip int) {
+	d.mu.Lock()
+	delete(d.breakpoints, ip)
+	d.mu.Unlock()
+}
+
+// ClearAll removes all breakpoints.
+func (d *Debugger) ClearAll() {
+	d.mu.Lock()
+	d.breakpoints = make(map[int]bool)
+	d.mu.Unlock()
+}
+
+// Breakpoints returns sorted positions of all breakpoints.
+func (d *Debugger) Breakpoints() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]int, 0, len(d.breakpoints))
+	for ip := range d.breakpoints {
+		out = append(out, ip)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// Continue runs program until next breakpoint. It returns false if program finished.
+func (d *Debugger) Continue() bool {
+	d.mode = debugContinue
+	return d.proceed()
+}
+
+// Step pauses before next opcode. First step pauses on the first opcode
+// of the program. It returns false if program finished.
+func (d *Debugger) Step() bool {
+	d.mode = debugStep
+	return d.proceed()
+}
+
+// StepOver runs program until it reaches opcode of another source location,
+// skipping over iterations of closures. It returns false if program finished.
+func (d *Debugger) StepOver() bool {
+	d.mode = debugStepOver
+	d.overLoc = d.Location()
+	d.overDepth = len(d.vm.scopes)
+	return d.proceed()
+}
+
+// Stop aborts program execution.
+func (d *Debugger) Stop() {
+	if !d.started || d.Done() {
+		return
+	}
+	d.aborted = true
+	d.resume <- struct{}{}
+	<-d.done
+}
+
+func (d *Debugger) proceed() bool {
+	if d.Done() {
+		return false
+	}
+	if !d.started {
+		d.started = true
+		go func() {
+			d.out, d.err = d.vm.Run(d.program, d.env)
+			close(d.done)
+		}()
+	} else {
+		d.resume <- struct{}{}
+	}
+	select {
+	case ip := <-d.paused:
+		d.ip = ip
+		return true
+	case <-d.done:
+		return false
+	}
+}
+
+// Done reports whether program finished.
+func (d *Debugger) Done() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Result returns output of finished program.
+func (d *Debugger) Result() (interface{}, error) {
+	return d.out, d.err
+}
+
+// IP returns position of opcode program is paused on.
+func (d *Debugger) IP() int {
+	return d.ip
+}
+
+// Location returns source location of opcode program is paused on.
+func (d *Debugger) Location() file.Location {
+	return d.program.Locations[d.ip]
+}
+
+// Stack returns copy of vm stack, top of the stack is the last element.
+func (d *Debugger) Stack() []interface{} {
+	return append([]interface{}(nil), d.vm.stack...)
+}
+
+// Scopes returns all closure scopes from outer to inner.
+func (d *Debugger) Scopes() []Scope {
+	return append([]Scope(nil), d.vm.scopes...)
+}
+
+func (d *Debugger) RunStart(*Program) {}
+
+func (d *Debugger) RunEnd(*Program, interface{}, error) {}
+
+func (d *Debugger) Opcode(ip int, _ byte) {
+	if d.aborted {
+		panic("debugger stopped")
+	}
+
+	d.mu.Lock()
+	pause := d.breakpoints[ip]
+	d.mu.Unlock()
+
+	switch d.mode {
+	case debugStep:
+		pause = true
+	case debugStepOver:
+		if d.program.Locations[ip] != d.overLoc && len(d.vm.scopes) <= d.overDepth {
+			pause = true
+		}
+	}
+	if !pause {
+		return
+	}
+
+	d.paused <- ip
+	<-d.resume
+
+	if d.aborted {
+		panic("debugger stopped")
+	}
+}
+
+func (d *Debugger) Call(string, bool, time.Duration) {}
+
+func (d *Debugger) Fetch(string, bool, time.Duration) {}
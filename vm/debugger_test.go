@@ -0,0 +1,92 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/byte-power/jsexpr/compiler"
+	"github.com/byte-power/jsexpr/conf"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/byte-power/jsexpr/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugger(t *testing.T) {
+	env := map[string]interface{}{"a": 1, "xs": []int{1, 2, 3}}
+	input := "a + 1 > 0 and\n  all(xs, {# > 0})"
+
+	tree, err := parser.Parse(input)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, conf.New(env))
+	require.NoError(t, err)
+
+	d := vm.NewDebugger(program, env)
+
+	require.True(t, d.Step())
+	require.Equal(t, 0, d.IP())
+	require.Empty(t, d.Stack())
+
+	require.True(t, d.Step())
+	require.Equal(t, []interface{}{1}, d.Stack())
+
+	ip, err := d.BreakAt(2, 13)
+	require.NoError(t, err)
+	require.Equal(t, []int{ip}, d.Breakpoints())
+
+	for i := 1; i <= 3; i++ {
+		require.True(t, d.Continue())
+		require.Equal(t, ip, d.IP())
+		require.Len(t, d.Scopes(), 1)
+		require.Equal(t, i-1, d.Scopes()[0]["i"])
+	}
+
+	d.ClearAll()
+	require.False(t, d.Continue())
+	require.True(t, d.Done())
+
+	out, err := d.Result()
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+}
+
+func TestDebugger_step_over(t *testing.T) {
+	env := map[string]interface{}{"xs": []int{1, 2, 3}}
+
+	tree, err := parser.Parse(`all(xs, {# > 0}) and true`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, conf.New(env))
+	require.NoError(t, err)
+
+	d := vm.NewDebugger(program, env)
+	_, err = d.BreakAt(1, 0)
+	require.NoError(t, err)
+	require.True(t, d.Continue())
+
+	steps := 0
+	for d.StepOver() {
+		require.Empty(t, d.Scopes(), "step over should not stop inside closure")
+		steps++
+	}
+	require.True(t, steps > 0)
+
+	out, err := d.Result()
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+}
+
+func TestDebugger_stop(t *testing.T) {
+	tree, err := parser.Parse(`1 + 2`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+
+	d := vm.NewDebugger(program, nil)
+	require.True(t, d.Step())
+	d.Stop()
+	require.True(t, d.Done())
+
+	_, err = d.Result()
+	require.Error(t, err)
+}
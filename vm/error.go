@@ -0,0 +1,119 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strings"
+
+	"github.com/byte-power/jsexpr/file"
+)
+
+// DefaultCallArgLimit is max length of argument representation in
+// CallError, unless program sets CallArgLimit.
+const DefaultCallArgLimit = 64
+
+// CallError is returned by Run when a function or method from env panics.
+// Errors raised by vm itself (wrong types, out of bounds, etc.) are
+// still reported as *file.Error.
+type CallError struct {
+	Location file.Location
+	Name     string      // Name of called function or method.
+	Method   bool        // True if Name is a method.
+	Args     []string    // Types and values of arguments, truncated to CallArgLimit of program.
+	Value    interface{} // Recovered panic value.
+	Stack    []byte      // Go stack of panic, only filled if CallStack of program is set.
+	Snippet  string
+}
+
+func (e *CallError) Error() string {
+	kind := "func"
+	if e.Method {
+		kind = "method"
+	}
+	f := &file.Error{
+		Location: e.Location,
+		Message:  fmt.Sprintf("%v %v(%v) panicked: %v", kind, e.Name, strings.Join(e.Args, ", "), e.Value),
+		Snippet:  e.Snippet,
+	}
+	if len(e.Stack) > 0 {
+		return f.Error() + "\n" + string(e.Stack)
+	}
+	return f.Error()
+}
+
+// Unwrap returns recovered panic value if it is an error.
+func (e *CallError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+func (e *CallError) bind(location file.Location, source *file.Source) *CallError {
+	e.Location = location
+	e.Snippet = (&file.Error{Location: location}).Bind(source).Snippet
+	return e
+}
+
+// guard must be deferred around calls to user code. It converts a panic
+// into *CallError, so Run is able to tell it apart from its own errors.
+// Arguments are either []reflect.Value or []interface{}, they are only
+// formatted if a panic happened.
+func (vm *VM) guard(name string, method bool, args interface{}) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	e := &CallError{
+		Name:   name,
+		Method: method,
+		Value:  r,
+	}
+	switch a := args.(type) {
+	case []reflect.Value:
+		for _, v := range a {
+			if v.IsValid() && v.CanInterface() {
+				e.Args = append(e.Args, formatArg(v.Interface(), vm.callArgLimit))
+			} else {
+				e.Args = append(e.Args, "nil")
+			}
+		}
+	case []interface{}:
+		for _, v := range a {
+			e.Args = append(e.Args, formatArg(v, vm.callArgLimit))
+		}
+	}
+	if vm.callStack {
+		e.Stack = debug.Stack()
+	}
+	panic(e)
+}
+
+// formatArg formats argument, truncating its value to limit runes,
+// if positive. Type of argument is not counted in limit.
+func formatArg(arg interface{}, limit int) string {
+	switch a := arg.(type) {
+	case nil:
+		return "nil"
+	case string:
+		if s, ok := truncate(a, limit); ok {
+			return fmt.Sprintf("string(%q...)", s)
+		}
+		return fmt.Sprintf("string(%q)", a)
+	default:
+		s, ok := truncate(fmt.Sprintf("%v", a), limit)
+		if ok {
+			s += "..."
+		}
+		return fmt.Sprintf("%T(%v)", a, s)
+	}
+}
+
+// truncate cuts s to limit runes, if positive, and reports whether it was cut.
+func truncate(s string, limit int) (string, bool) {
+	if r := []rune(s); limit > 0 && len(r) > limit {
+		return string(r[:limit]), true
+	}
+	return s, false
+}
@@ -0,0 +1,250 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/file"
+)
+
+// Explanation holds values of all sub-expressions of an evaluated program.
+type Explanation struct {
+	Source *file.Source
+	Output interface{}
+	Nodes  []ExplainedNode // In pre-order, same as Program.Spans.
+}
+
+type ExplainedNode struct {
+	Node     ast.Node
+	Location file.Location
+	Parent   int         // Index of parent node or -1 for the root.
+	Depth    int         // Depth of node in the tree, root has depth 0.
+	Value    interface{} // Last value node evaluated to.
+	Count    int         // How many times node was evaluated, nodes inside closures may be evaluated many times.
+}
+
+// ShortCircuited reports whether node was never evaluated,
+// for example right side of "or" if left side was true.
+func (n ExplainedNode) ShortCircuited() bool {
+	return n.Count == 0
+}
+
+// Explain runs program and records value of every sub-expression.
+// On runtime error partial explanation is returned along with the error.
+func Explain(program *Program, env interface{}) (*Explanation, error) {
+	if program == nil {
+		return nil, fmt.Errorf("program is nil")
+	}
+	if len(program.Spans) == 0 {
+		return nil, fmt.Errorf("program has no node spans, it should be compiled from source")
+	}
+
+	e := &explainer{
+		env:    env,
+		starts: make(map[int][]int),
+		ends:   make(map[int][]int),
+		parts:  make(map[int][]int),
+		active: make([]bool, len(program.Spans)),
+		explanation: &Explanation{
+			Source: program.Source,
+			Nodes:  make([]ExplainedNode, len(program.Spans)),
+		},
+	}
+	for i, span := range program.Spans {
+		depth := 0
+		if span.Parent >= 0 {
+			depth = e.explanation.Nodes[span.Parent].Depth + 1
+		}
+		e.explanation.Nodes[i] = ExplainedNode{
+			Node:     span.Node,
+			Location: span.Node.Location(),
+			Parent:   span.Parent,
+			Depth:    depth,
+		}
+		if span.Start == span.End && span.Parent >= 0 {
+			// Part of chain of properties fetched at once
+			// is evaluated along with the whole chain.
+			chain := span.Parent
+			for program.Spans[chain].Start == program.Spans[chain].End {
+				chain = program.Spans[chain].Parent
+			}
+			e.parts[chain] = append(e.parts[chain], i)
+			continue
+		}
+		e.starts[span.Start] = append(e.starts[span.Start], i)
+		e.ends[span.End] = append(e.ends[span.End], i)
+	}
+
+	e.vm = &VM{}
+	e.vm.Init(program, env)
+	e.vm.SetTracer(e)
+
+	out, err := e.vm.Run(program, env)
+	if err == nil {
+		e.explanation.Output = out
+	}
+	return e.explanation, err
+}
+
+// explainer is a tracer which looks on top of the stack
+// every time vm reaches the end of a node span.
+type explainer struct {
+	vm          *VM
+	env         interface{}
+	starts      map[int][]int
+	ends        map[int][]int
+	parts       map[int][]int // Parts of chains of properties by index of chain.
+	active      []bool
+	explanation *Explanation
+}
+
+func (e *explainer) RunStart(*Program) {}
+
+func (e *explainer) RunEnd(program *Program, out interface{}, err error) {
+	if err == nil {
+		e.reach(len(program.Bytecode), out)
+	}
+}
+
+func (e *explainer) Opcode(ip int, _ byte) {
+	var top interface{}
+	if stack := e.vm.Stack(); len(stack) > 0 {
+		top = stack[len(stack)-1]
+	}
+	e.reach(ip, top)
+	for _, i := range e.starts[ip] {
+		e.active[i] = true
+	}
+}
+
+func (e *explainer) reach(ip int, value interface{}) {
+	if provider, ok := value.(ValueProvider); ok {
+		value = provider.GetValue()
+	}
+	for _, i := range e.ends[ip] {
+		// Node may end at the same place as its short-circuited sibling,
+		// so only nodes which were started are recorded.
+		if e.active[i] {
+			e.active[i] = false
+			e.explanation.Nodes[i].Value = value
+			e.explanation.Nodes[i].Count++
+			for _, part := range e.parts[i] {
+				e.explain(part)
+			}
+		}
+	}
+}
+
+// explain records value of part of chain of properties, which is
+// fetched again, as vm fetches only the whole chain.
+func (e *explainer) explain(part int) {
+	value := e.vm.fetchField(e.env, Field{Names: names(e.explanation.Nodes[part].Node)})
+	if provider, ok := value.(ValueProvider); ok {
+		value = provider.GetValue()
+	}
+	e.explanation.Nodes[part].Value = value
+	e.explanation.Nodes[part].Count++
+}
+
+// names returns names of chain of properties.
+func names(node ast.Node) []string {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		return []string{n.Value}
+	case *ast.PropertyNode:
+		return append(names(n.Node), n.Property)
+	}
+	return nil
+}
+
+func (e *explainer) Call(string, bool, time.Duration) {}
+
+func (e *explainer) Fetch(string, bool, time.Duration) {}
+
+// String renders explanation as annotated tree of nodes.
+func (x *Explanation) String() string {
+	var b strings.Builder
+	for _, n := range x.Nodes {
+		b.WriteString(strings.Repeat("  ", n.Depth))
+		b.WriteString(label(n.Node))
+		if !n.Location.Empty() {
+			fmt.Fprintf(&b, " (%d:%d)", n.Location.Line, n.Location.Column+1)
+		}
+		if n.ShortCircuited() {
+			b.WriteString(" short-circuited")
+		} else {
+			fmt.Fprintf(&b, " = %v", formatValue(n))
+			if n.Count > 1 {
+				fmt.Fprintf(&b, " (evaluated %d times)", n.Count)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func label(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.NilNode:
+		return "nil"
+	case *ast.IdentifierNode:
+		return n.Value
+	case *ast.IntegerNode:
+		return fmt.Sprintf("%d", n.Value)
+	case *ast.FloatNode:
+		return fmt.Sprintf("%v", n.Value)
+	case *ast.BoolNode:
+		return fmt.Sprintf("%v", n.Value)
+	case *ast.StringNode:
+		return fmt.Sprintf("%q", n.Value)
+	case *ast.ConstantNode:
+		return ast.Print(n)
+	case *ast.UnaryNode:
+		return n.Operator
+	case *ast.BinaryNode:
+		return n.Operator
+	case *ast.MatchesNode:
+		return "matches"
+	case *ast.PropertyNode:
+		return "." + n.Property
+	case *ast.IndexNode:
+		return "[]"
+	case *ast.SliceNode:
+		return "[:]"
+	case *ast.MethodNode:
+		return "." + n.Method + "()"
+	case *ast.FunctionNode:
+		return n.Name + "()"
+	case *ast.BuiltinNode:
+		return n.Name + "()"
+	case *ast.ClosureNode:
+		return "{}"
+	case *ast.PointerNode:
+		return "#"
+	case *ast.ConditionalNode:
+		return "?:"
+	case *ast.ArrayNode:
+		return "[...]"
+	case *ast.MapNode:
+		return "{...}"
+	case *ast.PairNode:
+		return ":"
+	case *ast.ErrorNode:
+		return "<error>"
+	default:
+		return fmt.Sprintf("%T", node)
+	}
+}
+
+func formatValue(n ExplainedNode) string {
+	if c, ok := n.Node.(*ast.ConstantNode); ok {
+		// Constant is its own value, like sets made of arrays.
+		return ast.Print(c)
+	}
+	if s, ok := n.Value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%v", n.Value)
+}
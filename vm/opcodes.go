@@ -1,5 +1,7 @@
 package vm
 
+import "fmt"
+
 const (
 	OpPush byte = iota
 	OpPop
@@ -48,6 +50,114 @@ const (
 	OpStore
 	OpLoad
 	OpInc
+	OpEqualFloat
+	OpAddInt
+	OpAddFloat
+	OpConcatString
+	OpSubtractInt
+	OpSubtractFloat
+	OpMultiplyInt
+	OpMultiplyFloat
+	OpDivideInt
+	OpDivideFloat
+	OpModuloInt
+	OpLessInt
+	OpLessFloat
+	OpLessString
+	OpMoreInt
+	OpMoreFloat
+	OpMoreString
+	OpLessOrEqualInt
+	OpLessOrEqualFloat
+	OpLessOrEqualString
+	OpMoreOrEqualInt
+	OpMoreOrEqualFloat
+	OpMoreOrEqualString
+	OpFetchField
 	OpBegin
 	OpEnd // This opcode must be at the end of this list.
 )
+
+var opcodeNames = [...]string{
+	OpPush:              "OpPush",
+	OpPop:               "OpPop",
+	OpRot:               "OpRot",
+	OpFetch:             "OpFetch",
+	OpFetchMap:          "OpFetchMap",
+	OpTrue:              "OpTrue",
+	OpFalse:             "OpFalse",
+	OpNil:               "OpNil",
+	OpNegate:            "OpNegate",
+	OpNot:               "OpNot",
+	OpEqual:             "OpEqual",
+	OpEqualInt:          "OpEqualInt",
+	OpEqualString:       "OpEqualString",
+	OpJump:              "OpJump",
+	OpJumpIfTrue:        "OpJumpIfTrue",
+	OpJumpIfFalse:       "OpJumpIfFalse",
+	OpJumpBackward:      "OpJumpBackward",
+	OpIn:                "OpIn",
+	OpLess:              "OpLess",
+	OpMore:              "OpMore",
+	OpLessOrEqual:       "OpLessOrEqual",
+	OpMoreOrEqual:       "OpMoreOrEqual",
+	OpAdd:               "OpAdd",
+	OpSubtract:          "OpSubtract",
+	OpMultiply:          "OpMultiply",
+	OpDivide:            "OpDivide",
+	OpModulo:            "OpModulo",
+	OpExponent:          "OpExponent",
+	OpRange:             "OpRange",
+	OpMatches:           "OpMatches",
+	OpMatchesConst:      "OpMatchesConst",
+	OpContains:          "OpContains",
+	OpStartsWith:        "OpStartsWith",
+	OpEndsWith:          "OpEndsWith",
+	OpIndex:             "OpIndex",
+	OpSlice:             "OpSlice",
+	OpProperty:          "OpProperty",
+	OpCall:              "OpCall",
+	OpCallFast:          "OpCallFast",
+	OpMethod:            "OpMethod",
+	OpArray:             "OpArray",
+	OpMap:               "OpMap",
+	OpLen:               "OpLen",
+	OpCast:              "OpCast",
+	OpStore:             "OpStore",
+	OpLoad:              "OpLoad",
+	OpInc:               "OpInc",
+	OpEqualFloat:        "OpEqualFloat",
+	OpAddInt:            "OpAddInt",
+	OpAddFloat:          "OpAddFloat",
+	OpConcatString:      "OpConcatString",
+	OpSubtractInt:       "OpSubtractInt",
+	OpSubtractFloat:     "OpSubtractFloat",
+	OpMultiplyInt:       "OpMultiplyInt",
+	OpMultiplyFloat:     "OpMultiplyFloat",
+	OpDivideInt:         "OpDivideInt",
+	OpDivideFloat:       "OpDivideFloat",
+	OpModuloInt:         "OpModuloInt",
+	OpLessInt:           "OpLessInt",
+	OpLessFloat:         "OpLessFloat",
+	OpLessString:        "OpLessString",
+	OpMoreInt:           "OpMoreInt",
+	OpMoreFloat:         "OpMoreFloat",
+	OpMoreString:        "OpMoreString",
+	OpLessOrEqualInt:    "OpLessOrEqualInt",
+	OpLessOrEqualFloat:  "OpLessOrEqualFloat",
+	OpLessOrEqualString: "OpLessOrEqualString",
+	OpMoreOrEqualInt:    "OpMoreOrEqualInt",
+	OpMoreOrEqualFloat:  "OpMoreOrEqualFloat",
+	OpMoreOrEqualString: "OpMoreOrEqualString",
+	OpFetchField:        "OpFetchField",
+	OpBegin:             "OpBegin",
+	OpEnd:               "OpEnd",
+}
+
+// OpcodeName returns human readable name of opcode.
+func OpcodeName(op byte) string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("%#x", op)
+}
@@ -3,8 +3,13 @@ package vm
 import (
 	"encoding/binary"
 	"fmt"
+	"math/rand"
 	"regexp"
+	"strings"
+	"sync/atomic"
 
+	"github.com/byte-power/jsexpr/ast"
+	"github.com/byte-power/jsexpr/builtin"
 	"github.com/byte-power/jsexpr/file"
 )
 
@@ -13,6 +18,51 @@ type Program struct {
 	Locations map[int]file.Location `msgpack:"locations"`
 	Constants []interface{}         `msgpack:"constants"`
 	Bytecode  []byte                `msgpack:"bytecode"`
+	Wide      bool                  `msgpack:"wide"` // Operands are 4 bytes instead of 2.
+	Spans     []Span                `msgpack:"-"`
+	Branches  map[int]Branch        `msgpack:"-"`
+	Clock     builtin.Clock         `msgpack:"-"` // Clock of Date.now, nil for time.Now.
+	Rand      rand.Source           `msgpack:"-"` // Source of Math.random, nil for the global one.
+
+	// CallStack enables capturing of Go stack trace into CallError when
+	// a function or method called from expression panics. Stack capturing
+	// is slow, so it is meant to be turned on only for debugging.
+	CallStack bool `msgpack:"-"`
+	// CallArgLimit is max length of argument value in CallError, not counting its type,
+	// DefaultCallArgLimit if zero, negative for no limit.
+	CallArgLimit int `msgpack:"-"`
+
+	objs atomic.Value // Builtin objects with Clock and Rand, built by objects.
+}
+
+// objects returns builtin objects with Date.now reading Clock and
+// Math.random drawing from Rand. They are built once and shared by runs.
+func (program *Program) objects() map[string]interface{} {
+	if program.Clock == nil && program.Rand == nil {
+		return builtin.Objs()
+	}
+	if objs, ok := program.objs.Load().(map[string]interface{}); ok {
+		return objs
+	}
+	objs := builtin.ObjsWith(program.Clock, program.Rand)
+	program.objs.Store(objs)
+	return objs
+}
+
+// Span maps AST node to bytecode which computes it. Spans are stored in
+// pre-order, Parent is an index of parent span or -1 for the root.
+type Span struct {
+	Node   ast.Node
+	Parent int
+	Start  int
+	End    int
+}
+
+// Branch describes conditional jump. Cond is an index of span which value
+// is tested by the jump, if Negate is set the jump tests negated value.
+type Branch struct {
+	Cond   int
+	Negate bool
 }
 
 func (program *Program) Disassemble() string {
@@ -23,14 +73,23 @@ func (program *Program) Disassemble() string {
 		op := program.Bytecode[ip]
 		ip++
 
-		readArg := func() uint16 {
+		readArg := func() int {
+			if program.Wide {
+				if ip+3 >= len(program.Bytecode) {
+					return 0
+				}
+				i := binary.LittleEndian.Uint32(program.Bytecode[ip : ip+4])
+				ip += 4
+				return int(i)
+			}
+
 			if ip+1 >= len(program.Bytecode) {
 				return 0
 			}
 
 			i := binary.LittleEndian.Uint16([]byte{program.Bytecode[ip], program.Bytecode[ip+1]})
 			ip += 2
-			return i
+			return int(i)
 		}
 
 		code := func(label string) {
@@ -38,11 +97,11 @@ func (program *Program) Disassemble() string {
 		}
 		jump := func(label string) {
 			a := readArg()
-			out += fmt.Sprintf("%v\t%v\t%v\t(%v)\n", pp, label, a, ip+int(a))
+			out += fmt.Sprintf("%v\t%v\t%v\t(%v)\n", pp, label, a, ip+a)
 		}
 		back := func(label string) {
 			a := readArg()
-			out += fmt.Sprintf("%v\t%v\t%v\t(%v)\n", pp, label, a, ip-int(a))
+			out += fmt.Sprintf("%v\t%v\t%v\t(%v)\n", pp, label, a, ip-a)
 		}
 		argument := func(label string) {
 			a := readArg()
@@ -51,12 +110,15 @@ func (program *Program) Disassemble() string {
 		constant := func(label string) {
 			a := readArg()
 			var c interface{}
-			if int(a) < len(program.Constants) {
+			if a < len(program.Constants) {
 				c = program.Constants[a]
 			}
 			if r, ok := c.(*regexp.Regexp); ok {
 				c = r.String()
 			}
+			if f, ok := c.(Field); ok {
+				c = strings.Join(f.Names, ".")
+			}
 			out += fmt.Sprintf("%v\t%v\t%v\t%#v\n", pp, label, a, c)
 		}
 
@@ -202,6 +264,78 @@ func (program *Program) Disassemble() string {
 		case OpInc:
 			constant("OpInc")
 
+		case OpEqualFloat:
+			code("OpEqualFloat")
+
+		case OpAddInt:
+			code("OpAddInt")
+
+		case OpAddFloat:
+			code("OpAddFloat")
+
+		case OpConcatString:
+			code("OpConcatString")
+
+		case OpSubtractInt:
+			code("OpSubtractInt")
+
+		case OpSubtractFloat:
+			code("OpSubtractFloat")
+
+		case OpMultiplyInt:
+			code("OpMultiplyInt")
+
+		case OpMultiplyFloat:
+			code("OpMultiplyFloat")
+
+		case OpDivideInt:
+			code("OpDivideInt")
+
+		case OpDivideFloat:
+			code("OpDivideFloat")
+
+		case OpModuloInt:
+			code("OpModuloInt")
+
+		case OpLessInt:
+			code("OpLessInt")
+
+		case OpLessFloat:
+			code("OpLessFloat")
+
+		case OpLessString:
+			code("OpLessString")
+
+		case OpMoreInt:
+			code("OpMoreInt")
+
+		case OpMoreFloat:
+			code("OpMoreFloat")
+
+		case OpMoreString:
+			code("OpMoreString")
+
+		case OpLessOrEqualInt:
+			code("OpLessOrEqualInt")
+
+		case OpLessOrEqualFloat:
+			code("OpLessOrEqualFloat")
+
+		case OpLessOrEqualString:
+			code("OpLessOrEqualString")
+
+		case OpMoreOrEqualInt:
+			code("OpMoreOrEqualInt")
+
+		case OpMoreOrEqualFloat:
+			code("OpMoreOrEqualFloat")
+
+		case OpMoreOrEqualString:
+			code("OpMoreOrEqualString")
+
+		case OpFetchField:
+			constant("OpFetchField")
+
 		case OpBegin:
 			code("OpBegin")
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/byte-power/jsexpr/vm"
+	"github.com/stretchr/testify/require"
 )
 
 func TestProgram_Disassemble(t *testing.T) {
@@ -19,3 +20,21 @@ func TestProgram_Disassemble(t *testing.T) {
 		}
 	}
 }
+
+func TestProgram_Disassemble_wide(t *testing.T) {
+	program := vm.Program{
+		Constants: []interface{}{42},
+		Bytecode: []byte{
+			vm.OpTrue,
+			vm.OpJumpIfFalse, 1, 0, 0, 0,
+			vm.OpPop,
+			vm.OpPush, 0, 0, 0, 0,
+		},
+		Wide: true,
+	}
+	require.Equal(t, "0\tOpTrue\n1\tOpJumpIfFalse\t1\t(7)\n6\tOpPop\n7\tOpPush\t0\t42\n", program.Disassemble())
+
+	out, err := vm.Run(&program, nil)
+	require.NoError(t, err)
+	require.Equal(t, 42, out)
+}
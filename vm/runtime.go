@@ -6,48 +6,82 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sync"
 
 	"github.com/byte-power/jsexpr/utility"
 )
 
-type fieldReflection struct {
-	value reflect.Value
+// structFields caches field index paths of struct types,
+// keyed by field name or jsexpr tag. Fields of embedded structs are promoted.
+var structFields sync.Map // map[reflect.Type]map[string][]int
 
-	nestedFieldReflections map[string]fieldReflection
+func fieldsOf(t reflect.Type) map[string][]int {
+	if fields, ok := structFields.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	collectFields(t, nil, fields, map[reflect.Type]bool{})
+	structFields.Store(t, fields)
+	return fields
 }
 
-func structReflection(root reflect.Value) map[string]fieldReflection {
-	m := make(map[string]fieldReflection)
-	t := root.Type()
-	for i := 0; i < root.NumField(); i++ {
-		fieldValue := root.Field(i)
+func collectFields(t reflect.Type, index []int, fields map[string][]int, seen map[reflect.Type]bool) {
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
-		fieldKind := fieldValue.Kind()
-		fieldRef := fieldReflection{
-			value: fieldValue,
-		}
-		if fieldKind == reflect.Ptr {
-			fieldKind = reflect.Indirect(fieldValue).Kind()
-			fieldValue = reflect.Indirect(fieldValue)
-		}
-		nested := make(map[string]fieldReflection)
-		if fieldKind == reflect.Struct {
-			if field.Anonymous {
-				for k, v := range structReflection(fieldValue) {
-					m[k] = v
-				}
-			} else {
-				nested = structReflection(fieldValue)
+		path := append(append([]int(nil), index...), i)
+		if field.Anonymous {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !seen[ft] {
+				collectFields(ft, path, fields, seen)
 			}
 		}
-		fieldRef.nestedFieldReflections = nested
-		fieldName := field.Name
+		name := field.Name
 		if tag := field.Tag.Get(utility.StructTagKey); tag != "" {
-			fieldName = tag
+			name = tag
+		}
+		fields[name] = path
+	}
+	delete(seen, t)
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, but reports
+// nil pointers to embedded structs instead of panicking.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
 		}
-		m[fieldName] = fieldRef
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+var propertyProviderType = reflect.TypeOf((*PropertyProvider)(nil)).Elem()
+
+// FieldIndex returns index path of field name of struct type t, as VM fetches it.
+// It returns false for types implementing PropertyProvider.
+func FieldIndex(t reflect.Type, name string) ([]int, bool) {
+	if t.Kind() != reflect.Struct || t.Implements(propertyProviderType) || reflect.PtrTo(t).Implements(propertyProviderType) {
+		return nil, false
 	}
-	return m
+	index, ok := fieldsOf(t)[name]
+	return index, ok
+}
+
+// Field is an operand of OpFetchField: fields Names of env of Type
+// resolved to index Path. Deserialized programs have no Type, so they
+// fetch fields by names.
+type Field struct {
+	Names []string     `msgpack:"names"`
+	Path  []int        `msgpack:"path"`
+	Type  reflect.Type `msgpack:"-"`
 }
 
 type Call struct {
@@ -7,3 +7,11 @@ type PropertyProvider interface {
 type ValueProvider interface {
 	GetValue() interface{}
 }
+
+// Resolver lazily provides root variables of env. Fetches of root variables
+// consult Resolve first and fall back to regular fetch if name is not
+// resolved. Results of Resolve, resolved or not, are memoized for the
+// duration of a run.
+type Resolver interface {
+	Resolve(name string) (interface{}, bool)
+}
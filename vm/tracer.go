@@ -0,0 +1,158 @@
+package vm
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tracer receives callbacks during program execution. Tracer is attached
+// to a VM with SetTracer or passed to RunWithTracer. All callbacks are
+// called synchronously from the VM loop, so they should be cheap.
+type Tracer interface {
+	// RunStart is called before the first opcode is executed.
+	RunStart(program *Program)
+	// RunEnd is called after the program finished, err is the error returned by Run.
+	RunEnd(program *Program, out interface{}, err error)
+	// Opcode is called before every opcode is dispatched.
+	Opcode(ip int, op byte)
+	// Call is called after a function or method from env returned.
+	Call(name string, method bool, duration time.Duration)
+	// Fetch is called after a variable (root is true) or a property is fetched.
+	Fetch(name string, root bool, duration time.Duration)
+}
+
+// RunWithTracer evaluates given bytecode program and reports execution to tracer.
+func RunWithTracer(program *Program, env interface{}, tracer Tracer) (interface{}, error) {
+	if program == nil {
+		return nil, fmt.Errorf("program is nil")
+	}
+
+	vm := VM{}
+	vm.Init(program, env)
+	vm.SetTracer(tracer)
+	return vm.Run(program, env)
+}
+
+// SetTracer attaches tracer to the VM, nil detaches it.
+func (vm *VM) SetTracer(tracer Tracer) {
+	vm.tracer = tracer
+}
+
+// CallStat holds aggregated timings of a function or method.
+type CallStat struct {
+	Count int64
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Profiler is a Tracer which aggregates opcode counts and time spent
+// in functions and methods by name. It is safe to share one Profiler
+// between concurrent runs.
+type Profiler struct {
+	runs    int64
+	opcodes [256]int64
+
+	mu      sync.Mutex
+	calls   map[string]*CallStat
+	fetches map[string]*CallStat
+}
+
+// NewProfiler returns empty Profiler.
+func NewProfiler() *Profiler {
+	return &Profiler{
+		calls:   make(map[string]*CallStat),
+		fetches: make(map[string]*CallStat),
+	}
+}
+
+// RunStart counts run.
+func (p *Profiler) RunStart(*Program) {
+	atomic.AddInt64(&p.runs, 1)
+}
+
+// RunEnd does nothing, runs are counted at start.
+func (p *Profiler) RunEnd(*Program, interface{}, error) {}
+
+// Opcode counts dispatch of op.
+func (p *Profiler) Opcode(_ int, op byte) {
+	atomic.AddInt64(&p.opcodes[op], 1)
+}
+
+// Call records duration of call to function or method name.
+func (p *Profiler) Call(name string, _ bool, duration time.Duration) {
+	p.mu.Lock()
+	record(p.calls, name, duration)
+	p.mu.Unlock()
+}
+
+// Fetch records duration of fetch of variable or property name.
+func (p *Profiler) Fetch(name string, _ bool, duration time.Duration) {
+	p.mu.Lock()
+	record(p.fetches, name, duration)
+	p.mu.Unlock()
+}
+
+func record(stats map[string]*CallStat, name string, duration time.Duration) {
+	s, ok := stats[name]
+	if !ok {
+		s = &CallStat{}
+		stats[name] = s
+	}
+	s.Count++
+	s.Total += duration
+	if duration > s.Max {
+		s.Max = duration
+	}
+}
+
+// Runs returns number of traced runs.
+func (p *Profiler) Runs() int64 {
+	return atomic.LoadInt64(&p.runs)
+}
+
+// Opcodes returns number of dispatches by opcode name.
+func (p *Profiler) Opcodes() map[string]int64 {
+	out := make(map[string]int64)
+	for op := range p.opcodes {
+		if n := atomic.LoadInt64(&p.opcodes[op]); n > 0 {
+			out[OpcodeName(byte(op))] = n
+		}
+	}
+	return out
+}
+
+// Calls returns timings of functions and methods by name.
+func (p *Profiler) Calls() map[string]CallStat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return copyStats(p.calls)
+}
+
+// Fetches returns timings of variable and property fetches by name.
+func (p *Profiler) Fetches() map[string]CallStat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return copyStats(p.fetches)
+}
+
+// Reset clears all collected data.
+func (p *Profiler) Reset() {
+	atomic.StoreInt64(&p.runs, 0)
+	for op := range p.opcodes {
+		atomic.StoreInt64(&p.opcodes[op], 0)
+	}
+	p.mu.Lock()
+	p.calls = make(map[string]*CallStat)
+	p.fetches = make(map[string]*CallStat)
+	p.mu.Unlock()
+}
+
+func copyStats(stats map[string]*CallStat) map[string]CallStat {
+	out := make(map[string]CallStat, len(stats))
+	for name, s := range stats {
+		out[name] = *s
+	}
+	return out
+}
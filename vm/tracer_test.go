@@ -0,0 +1,72 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/byte-power/jsexpr/compiler"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/byte-power/jsexpr/vm"
+	"github.com/stretchr/testify/require"
+)
+
+type traceEnv struct {
+	User struct {
+		Age int
+	}
+}
+
+func (traceEnv) Double(i int) int {
+	return i * 2
+}
+
+func TestRunWithTracer_profiler(t *testing.T) {
+	tree, err := parser.Parse(`double(User.Age) > 10 and double(1) == 2`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+
+	env := traceEnv{}
+	env.User.Age = 18
+
+	profiler := vm.NewProfiler()
+	for i := 0; i < 3; i++ {
+		out, err := vm.RunWithTracer(program, env, profiler)
+		require.NoError(t, err)
+		require.Equal(t, true, out)
+	}
+
+	require.Equal(t, int64(3), profiler.Runs())
+	require.Equal(t, int64(6), profiler.Calls()["double"].Count)
+	require.Equal(t, int64(3), profiler.Fetches()["User"].Count)
+	require.Equal(t, int64(3), profiler.Fetches()["Age"].Count)
+	require.Equal(t, int64(6), profiler.Opcodes()["OpCall"])
+	require.Equal(t, int64(3), profiler.Opcodes()["OpJumpIfFalse"])
+
+	profiler.Reset()
+	require.Equal(t, int64(0), profiler.Runs())
+	require.Empty(t, profiler.Calls())
+	require.Empty(t, profiler.Opcodes())
+}
+
+type endTracer struct {
+	*vm.Profiler
+	err error
+}
+
+func (e *endTracer) RunEnd(_ *vm.Program, _ interface{}, err error) {
+	e.err = err
+}
+
+func TestRunWithTracer_run_end_error(t *testing.T) {
+	tree, err := parser.Parse(`1 / (1 - 1)`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+
+	tracer := &endTracer{Profiler: vm.NewProfiler()}
+	_, err = vm.RunWithTracer(program, nil, tracer)
+	require.Error(t, err)
+	require.Equal(t, err, tracer.err)
+}
@@ -0,0 +1,221 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/byte-power/jsexpr/ast"
+)
+
+// Unknown is a value of variables missing from env in three-valued mode.
+var Unknown = unknown{}
+
+type unknown struct{}
+
+func (unknown) String() string {
+	return "unknown"
+}
+
+// RunKleene evaluates program in three-valued mode: variables and properties
+// missing from env evaluate to Unknown instead of failing with "cannot fetch".
+// Unknown propagates through operators and function calls, while logical
+// operators follow Kleene logic: `unknown and false` is false and
+// `unknown or true` is true. Result of a boolean program is true, false or Unknown.
+func RunKleene(program *Program, env interface{}) (interface{}, error) {
+	if program == nil {
+		return nil, fmt.Errorf("program is nil")
+	}
+	if len(program.Spans) == 0 {
+		return nil, fmt.Errorf("program has no node spans, it should be compiled from source")
+	}
+
+	vm := VM{kleene: true}
+	vm.Init(program, env)
+	return vm.Run(program, env)
+}
+
+// pending is a node which observed Unknown condition
+// and must adjust its result once evaluated.
+type pending struct {
+	span int
+	end  int
+	kind string
+}
+
+func isUnknown(v interface{}) bool {
+	_, ok := v.(unknown)
+	return ok
+}
+
+// unknownOp evaluates opcode if some of its operands are Unknown,
+// it returns false if opcode must be evaluated as usual.
+func (vm *VM) unknownOp(program *Program, op byte) bool {
+	switch op {
+	case OpNegate, OpNot:
+		return isUnknown(vm.current())
+
+	case OpCast, OpMatchesConst, OpProperty:
+		if isUnknown(vm.current()) {
+			vm.arg()
+			return true
+		}
+
+	case OpLen:
+		if isUnknown(vm.current()) {
+			vm.push(Unknown)
+			return true
+		}
+
+	case OpEqual, OpEqualInt, OpEqualString, OpIn, OpLess, OpMore, OpLessOrEqual, OpMoreOrEqual,
+		OpAdd, OpSubtract, OpMultiply, OpDivide, OpModulo, OpExponent, OpRange,
+		OpMatches, OpContains, OpStartsWith, OpEndsWith, OpIndex,
+		OpEqualFloat, OpAddInt, OpAddFloat, OpConcatString, OpSubtractInt, OpSubtractFloat,
+		OpMultiplyInt, OpMultiplyFloat, OpDivideInt, OpDivideFloat, OpModuloInt,
+		OpLessInt, OpLessFloat, OpLessString, OpMoreInt, OpMoreFloat, OpMoreString,
+		OpLessOrEqualInt, OpLessOrEqualFloat, OpLessOrEqualString,
+		OpMoreOrEqualInt, OpMoreOrEqualFloat, OpMoreOrEqualString:
+		return vm.replaceUnknown(2)
+
+	case OpSlice:
+		return vm.replaceUnknown(3)
+
+	case OpCall, OpCallFast, OpMethod:
+		ip := vm.ip
+		call := vm.getCall()
+		n := call.Size
+		if op == OpMethod {
+			n++ // Receiver.
+		}
+		if vm.replaceUnknown(n) {
+			return true
+		}
+		vm.ip = ip
+
+	case OpJumpIfTrue, OpJumpIfFalse:
+		if isUnknown(vm.current()) {
+			vm.unknownJump(program)
+			return true
+		}
+	}
+	return false
+}
+
+// replaceUnknown replaces n operands on top of the stack with
+// Unknown, if one of them is Unknown.
+func (vm *VM) replaceUnknown(n int) bool {
+	if n > len(vm.stack) {
+		return false
+	}
+	for _, v := range vm.stack[len(vm.stack)-n:] {
+		if isUnknown(v) {
+			vm.stack = append(vm.stack[:len(vm.stack)-n], Unknown)
+			return true
+		}
+	}
+	return false
+}
+
+// unknownJump decides where to continue when condition of a jump is Unknown.
+func (vm *VM) unknownJump(program *Program) {
+	branch, ok := program.Branches[vm.pp]
+	if !ok {
+		// It is a loop condition, so iterated collection is Unknown.
+		vm.abortLoop(program)
+		return
+	}
+	owner := program.Spans[branch.Cond].Parent
+	span := program.Spans[owner]
+
+	switch n := span.Node.(type) {
+	case *ast.BinaryNode:
+		// Evaluate right side, and combine result with Unknown later.
+		vm.arg()
+		kind := "and"
+		if n.Operator == "or" || n.Operator == "||" {
+			kind = "or"
+		}
+		vm.await(owner, span.End, kind)
+
+	case *ast.ConditionalNode:
+		vm.ip = span.End
+
+	case *ast.BuiltinNode:
+		switch n.Name {
+		case "all", "none", "any":
+			// Continue as if predicate did not decide the result.
+			vm.arg()
+		default:
+			// Skip element.
+			offset := vm.arg()
+			vm.ip += offset
+		}
+		vm.await(owner, span.End, n.Name)
+
+	default:
+		panic(fmt.Sprintf("unexpected unknown condition of %T", span.Node))
+	}
+}
+
+// abortLoop finishes the innermost closure builtin with Unknown result.
+func (vm *VM) abortLoop(program *Program) {
+	inner := -1
+	for i, span := range program.Spans {
+		if _, ok := span.Node.(*ast.BuiltinNode); ok && span.Start <= vm.pp && vm.pp < span.End {
+			inner = i
+		}
+	}
+	if inner == -1 {
+		panic("unknown loop condition")
+	}
+	vm.scopes = vm.scopes[:len(vm.scopes)-1]
+	vm.ip = program.Spans[inner].End
+}
+
+func (vm *VM) await(span, end int, kind string) {
+	for _, p := range vm.pending {
+		if p.span == span {
+			return
+		}
+	}
+	vm.pending = append(vm.pending, pending{span: span, end: end, kind: kind})
+}
+
+// settle adjusts results of nodes ending at ip which observed Unknown conditions.
+func (vm *VM) settle(ip int) {
+	for {
+		found := -1
+		for i, p := range vm.pending {
+			if p.end == ip && (found == -1 || p.span > vm.pending[found].span) {
+				found = i
+			}
+		}
+		if found == -1 {
+			return
+		}
+		p := vm.pending[found]
+		vm.pending = append(vm.pending[:found], vm.pending[found+1:]...)
+
+		top := len(vm.stack) - 1
+		result := vm.stack[top]
+		switch p.kind {
+		case "and":
+			if result != false {
+				result = Unknown
+			}
+		case "or":
+			if result != true {
+				result = Unknown
+			}
+		case "all", "none":
+			if result == true {
+				result = Unknown
+			}
+		case "any":
+			if result == false {
+				result = Unknown
+			}
+		default:
+			result = Unknown
+		}
+		vm.stack[top] = result
+	}
+}
@@ -0,0 +1,76 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/byte-power/jsexpr/compiler"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/byte-power/jsexpr/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunKleene(t *testing.T) {
+	env := map[string]interface{}{
+		"t":    true,
+		"f":    false,
+		"age":  21,
+		"user": map[string]interface{}{"name": "Bob"},
+		"xs":   []interface{}{1, 2, 3},
+		"ys": []interface{}{
+			map[string]interface{}{"v": 1},
+			map[string]interface{}{},
+		},
+	}
+
+	tests := []struct {
+		input  string
+		output interface{}
+	}{
+		{`u and f`, false},
+		{`u and t`, vm.Unknown},
+		{`f and u`, false},
+		{`u or t`, true},
+		{`u or f`, vm.Unknown},
+		{`t or u`, true},
+		{`!u`, vm.Unknown},
+		{`u == 1`, vm.Unknown},
+		{`u != 1 and age > 30`, false},
+		{`age + u > 1 || age > 18`, true},
+		{`(u > 1 and u < 10) or (age > 18 and user.name == "Bob")`, true},
+		{`user.email endsWith ".com"`, vm.Unknown},
+		{`u.deep.path == 1 or user.name == "Alice"`, vm.Unknown},
+		{`u ? 1 : 2`, vm.Unknown},
+		{`t ? u : 2`, vm.Unknown},
+		{`len(u) > 0`, vm.Unknown},
+		{`all(u, {# > 0})`, vm.Unknown},
+		{`all(u, {# > 0}) and f`, false},
+		{`map(u, {# * 2})`, vm.Unknown},
+		{`all(ys, {.v > 0})`, vm.Unknown},
+		{`all(ys, {.v > 1})`, false},
+		{`any(ys, {.v > 0})`, true},
+		{`any(ys, {.v > 1})`, vm.Unknown},
+		{`none(ys, {.v > 0})`, false},
+		{`none(ys, {.v > 1})`, vm.Unknown},
+		{`count(ys, {.v > 0})`, vm.Unknown},
+		{`filter(xs, {# > u})`, vm.Unknown},
+		{`count(xs, {# > 1})`, 2},
+		{`all(xs, {u or # > 0})`, true},
+	}
+
+	for _, test := range tests {
+		tree, err := parser.Parse(test.input)
+		require.NoError(t, err, test.input)
+
+		program, err := compiler.Compile(tree, nil)
+		require.NoError(t, err, test.input)
+
+		out, err := vm.RunKleene(program, env)
+		require.NoError(t, err, test.input)
+		require.Equal(t, test.output, out, test.input)
+	}
+}
+
+func TestRunKleene_requires_spans(t *testing.T) {
+	_, err := vm.RunKleene(&vm.Program{}, nil)
+	require.Error(t, err)
+}
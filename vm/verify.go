@@ -0,0 +1,429 @@
+package vm
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// maxFrames limits number of accumulated stack regions verifier tracks.
+const maxFrames = 64
+
+// Verify statically checks that program can be run safely: every opcode is
+// known, operands are in bounds, constants have types expected by opcodes,
+// stack never underflows and holds exactly the result at exit, and
+// OpBegin/OpEnd are balanced on every path.
+func Verify(program *Program) error {
+	if program == nil {
+		return fmt.Errorf("program is nil")
+	}
+	v := &verifier{
+		program: program,
+		size:    2,
+		states:  make(map[int]*stackState),
+	}
+	if program.Wide {
+		v.size = 4
+	}
+	if err := v.decode(); err != nil {
+		return err
+	}
+	return v.run()
+}
+
+type instruction struct {
+	op   byte
+	arg  int
+	next int
+}
+
+type verifier struct {
+	program *Program
+	size    int
+	code    map[int]instruction
+	states  map[int]*stackState
+	queue   []int
+}
+
+// stackState is an abstract stack. Stack holds frames[0] values, then for
+// each following frame an unknown number of values accumulated by loops
+// (like results of map builtin), followed by frame number of values.
+// Known is a value of int constant on top of the stack, or -1.
+type stackState struct {
+	frames []int
+	scopes int
+	known  int
+}
+
+func (s *stackState) equal(o *stackState) bool {
+	if len(s.frames) != len(o.frames) || s.scopes != o.scopes || s.known != o.known {
+		return false
+	}
+	for i := range s.frames {
+		if s.frames[i] != o.frames[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *verifier) errorf(ip int, format string, args ...interface{}) error {
+	op := v.program.Bytecode[ip]
+	return fmt.Errorf("invalid program at %v (%v): %v", ip, OpcodeName(op), fmt.Sprintf(format, args...))
+}
+
+// decode splits bytecode into instructions and checks their operands.
+func (v *verifier) decode() error {
+	bytecode := v.program.Bytecode
+	v.code = make(map[int]instruction)
+	for ip := 0; ip < len(bytecode); {
+		op := bytecode[ip]
+		if op > OpEnd {
+			return v.errorf(ip, "unknown opcode")
+		}
+		in := instruction{op: op, next: ip + 1}
+		if hasOperand(op) {
+			if ip+1+v.size > len(bytecode) {
+				return v.errorf(ip, "operand is out of bytecode")
+			}
+			in.arg = v.operand(ip + 1)
+			in.next += v.size
+		}
+		if err := v.checkOperand(ip, in); err != nil {
+			return err
+		}
+		v.code[ip] = in
+		ip = in.next
+	}
+	return nil
+}
+
+func (v *verifier) operand(pos int) int {
+	b := v.program.Bytecode[pos:]
+	if v.size == 4 {
+		return int(uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24)
+	}
+	return int(uint16(b[0]) | uint16(b[1])<<8)
+}
+
+func hasOperand(op byte) bool {
+	switch op {
+	case OpPush, OpFetch, OpFetchField, OpFetchMap, OpJump, OpJumpIfTrue, OpJumpIfFalse, OpJumpBackward,
+		OpMatchesConst, OpProperty, OpCall, OpCallFast, OpMethod, OpCast, OpStore, OpLoad, OpInc:
+		return true
+	}
+	return false
+}
+
+func (v *verifier) checkOperand(ip int, in instruction) error {
+	switch in.op {
+	case OpJump, OpJumpIfTrue, OpJumpIfFalse:
+		if in.next+in.arg > len(v.program.Bytecode) {
+			return v.errorf(ip, "jump target %v is out of bytecode", in.next+in.arg)
+		}
+		return nil
+	case OpJumpBackward:
+		if in.next-in.arg < 0 {
+			return v.errorf(ip, "jump target %v is out of bytecode", in.next-in.arg)
+		}
+		return nil
+	case OpCast:
+		if in.arg != 0 && in.arg != 1 {
+			return v.errorf(ip, "unknown cast %v", in.arg)
+		}
+		return nil
+	}
+	if !hasOperand(in.op) {
+		return nil
+	}
+
+	if in.arg >= len(v.program.Constants) {
+		return v.errorf(ip, "constant %v is out of %v constants", in.arg, len(v.program.Constants))
+	}
+	c := v.program.Constants[in.arg]
+	ok := true
+	switch in.op {
+	case OpPush:
+	case OpFetch, OpFetchMap, OpProperty, OpStore, OpLoad, OpInc:
+		_, ok = c.(string)
+	case OpFetchField:
+		field, is := fieldOf(c)
+		ok = is && len(field.Names) > 0
+	case OpMatchesConst:
+		_, ok = c.(*regexp.Regexp)
+	case OpCall, OpCallFast, OpMethod:
+		switch call := c.(type) {
+		case Call:
+			ok = call.Size >= 0
+		case map[string]interface{}:
+			// Call decoded with msgpack.
+			_, ok = call["name"].(string)
+		default:
+			ok = false
+		}
+	}
+	if !ok {
+		return v.errorf(ip, "unexpected constant %T", c)
+	}
+	return nil
+}
+
+func (v *verifier) run() error {
+	if len(v.program.Bytecode) == 0 {
+		return nil
+	}
+	if err := v.flow(0, 0, &stackState{frames: []int{0}, known: -1}); err != nil {
+		return err
+	}
+
+	// Abstract states only get more general, limit the number of
+	// steps in case they don't converge.
+	limit := 64 * (len(v.code) + 1)
+	for steps := 0; len(v.queue) > 0; steps++ {
+		if steps > limit {
+			return fmt.Errorf("invalid program: stack does not converge")
+		}
+		ip := v.queue[len(v.queue)-1]
+		v.queue = v.queue[:len(v.queue)-1]
+		if err := v.step(ip); err != nil {
+			return err
+		}
+	}
+
+	exit, ok := v.states[len(v.program.Bytecode)]
+	if !ok {
+		return fmt.Errorf("invalid program: end of bytecode is unreachable")
+	}
+	if exit.scopes != 0 {
+		return fmt.Errorf("invalid program: %v scopes are not closed at exit", exit.scopes)
+	}
+	if len(exit.frames) != 1 || exit.frames[0] != 1 {
+		return fmt.Errorf("invalid program: stack is not balanced at exit")
+	}
+	return nil
+}
+
+// flow merges state into the state of instruction at ip.
+func (v *verifier) flow(from, ip int, state *stackState) error {
+	if _, ok := v.code[ip]; !ok && ip != len(v.program.Bytecode) {
+		return v.errorf(from, "jump into the middle of instruction at %v", ip)
+	}
+	exit := ip == len(v.program.Bytecode)
+	old, ok := v.states[ip]
+	if !ok {
+		v.states[ip] = state
+		if !exit {
+			v.queue = append(v.queue, ip)
+		}
+		return nil
+	}
+	if old.scopes != state.scopes {
+		return v.errorf(from, "scopes depth %v does not match %v at %v", state.scopes, old.scopes, ip)
+	}
+	merged := merge(old, state)
+	if len(merged.frames) > maxFrames {
+		return v.errorf(from, "stack is too complex")
+	}
+	if !merged.equal(old) {
+		v.states[ip] = merged
+		if !exit {
+			v.queue = append(v.queue, ip)
+		}
+	}
+	return nil
+}
+
+// merge returns state which describes both stacks a and b.
+func merge(a, b *stackState) *stackState {
+	known := a.known
+	if a.known != b.known {
+		known = -1
+	}
+	r := &stackState{scopes: a.scopes, known: known}
+
+	i := 0
+	for i < len(a.frames) && i < len(b.frames) && a.frames[i] == b.frames[i] {
+		i++
+	}
+	if i == len(a.frames) && i == len(b.frames) {
+		r.frames = a.frames
+		return r
+	}
+	if i > len(a.frames)-1 {
+		i = len(a.frames) - 1
+	}
+	if i > len(b.frames)-1 {
+		i = len(b.frames) - 1
+	}
+
+	bottom := min(a.frames[i], b.frames[i])
+	r.frames = append(append([]int(nil), a.frames[:i]...), bottom)
+	last := i == len(a.frames)-1 && i == len(b.frames)-1
+	if last && i > 0 {
+		// Extra values are absorbed by preceding accumulated values.
+		return r
+	}
+	r.frames = append(r.frames, min(top(a, i, bottom), top(b, i, bottom)))
+	return r
+}
+
+func top(s *stackState, i, bottom int) int {
+	if i == len(s.frames)-1 {
+		return s.frames[i] - bottom
+	}
+	return s.frames[len(s.frames)-1]
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (v *verifier) step(ip int) error {
+	in := v.code[ip]
+	s := v.states[ip]
+	state := &stackState{
+		frames: append([]int(nil), s.frames...),
+		scopes: s.scopes,
+		known:  -1,
+	}
+	depth := &state.frames[len(state.frames)-1]
+
+	pop := func(n int) error {
+		if *depth < n {
+			return v.errorf(ip, "stack underflow")
+		}
+		*depth -= n
+		return nil
+	}
+
+	switch in.op {
+	case OpPush:
+		if i, ok := v.program.Constants[in.arg].(int); ok {
+			state.known = i
+		}
+		*depth++
+
+	case OpFetch, OpFetchField, OpFetchMap, OpTrue, OpFalse, OpNil:
+		*depth++
+
+	case OpLoad:
+		if state.scopes == 0 {
+			return v.errorf(ip, "no scope")
+		}
+		*depth++
+
+	case OpPop:
+		if err := pop(1); err != nil {
+			return err
+		}
+
+	case OpStore:
+		if state.scopes == 0 {
+			return v.errorf(ip, "no scope")
+		}
+		if err := pop(1); err != nil {
+			return err
+		}
+
+	case OpInc:
+		if state.scopes == 0 {
+			return v.errorf(ip, "no scope")
+		}
+
+	case OpRot:
+		if *depth < 2 {
+			return v.errorf(ip, "stack underflow")
+		}
+
+	case OpLen:
+		if *depth < 1 {
+			return v.errorf(ip, "stack underflow")
+		}
+		*depth++
+
+	case OpNegate, OpNot, OpMatchesConst, OpProperty, OpCast:
+		if err := pop(1); err != nil {
+			return err
+		}
+		*depth++
+
+	case OpSlice:
+		if err := pop(3); err != nil {
+			return err
+		}
+		*depth++
+
+	case OpCall, OpCallFast, OpMethod:
+		n := 0
+		switch call := v.program.Constants[in.arg].(type) {
+		case Call:
+			n = call.Size
+		case map[string]interface{}:
+			n = AnyToInt(call["size"])
+		}
+		if in.op == OpMethod {
+			n++ // Receiver.
+		}
+		if err := pop(n); err != nil {
+			return err
+		}
+		*depth++
+
+	case OpArray, OpMap:
+		size := s.known
+		if err := pop(1); err != nil {
+			return err
+		}
+		if size >= 0 {
+			if in.op == OpMap {
+				size *= 2
+			}
+			if err := pop(size); err != nil {
+				return err
+			}
+		} else {
+			// Size is computed at runtime, collection
+			// takes all values accumulated by a loop.
+			if len(state.frames) < 2 {
+				return v.errorf(ip, "size of collection is unknown")
+			}
+			state.frames = state.frames[:len(state.frames)-1]
+			depth = &state.frames[len(state.frames)-1]
+		}
+		*depth++
+
+	case OpBegin:
+		state.scopes++
+
+	case OpEnd:
+		if state.scopes == 0 {
+			return v.errorf(ip, "no scope to end")
+		}
+		state.scopes--
+
+	case OpJumpIfTrue, OpJumpIfFalse:
+		if *depth < 1 {
+			return v.errorf(ip, "stack underflow")
+		}
+		if err := v.flow(ip, in.next+in.arg, state); err != nil {
+			return err
+		}
+
+	case OpJump:
+		return v.flow(ip, in.next+in.arg, state)
+
+	case OpJumpBackward:
+		return v.flow(ip, in.next-in.arg, state)
+
+	default:
+		// Binary operators.
+		if err := pop(2); err != nil {
+			return err
+		}
+		*depth++
+	}
+
+	return v.flow(ip, in.next, state)
+}
@@ -0,0 +1,130 @@
+package vm_test
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/byte-power/jsexpr/compiler"
+	"github.com/byte-power/jsexpr/parser"
+	"github.com/byte-power/jsexpr/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []string{
+		`a + 1`,
+		`a or b(1) and not c`,
+		`true ? [1, 2] : {"a": x, "b": [y]}`,
+		`all(a, {# > 0}) || none(a, {# > 1}) && any(a, {# > 2}) and one(a, {# == 3})`,
+		`filter(a, {# > 0})`,
+		`map(a, {map(#, {# + 1})})`,
+		`map(filter(a, {len(map(#, {#})) > 0}), {count(#, {# > 1})})`,
+		`len(a[1:2]) + a.b.c(1, 2) - x matches "^a"`,
+		`s matches p and s startsWith "a"`,
+	}
+
+	for _, input := range tests {
+		tree, err := parser.Parse(input)
+		require.NoError(t, err, input)
+
+		program, err := compiler.Compile(tree, nil)
+		require.NoError(t, err, input)
+		require.NoError(t, vm.Verify(program), input)
+	}
+}
+
+func TestVerify_wide(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(`x == 0`)
+	for i := 1; i < 70000; i++ {
+		fmt.Fprintf(&b, ` or x == %v`, i)
+	}
+	tree, err := parser.Parse(b.String())
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+	require.True(t, program.Wide)
+	require.NoError(t, vm.Verify(program))
+}
+
+func TestVerify_errors(t *testing.T) {
+	call := vm.Call{Name: "f", Size: 2}
+	tests := []struct {
+		program vm.Program
+		err     string
+	}{
+		{
+			vm.Program{Bytecode: []byte{0xFF}},
+			"invalid program at 0 (0xff): unknown opcode",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpPush, 0}},
+			"invalid program at 0 (OpPush): operand is out of bytecode",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpPush, 1, 0}, Constants: []interface{}{1}},
+			"invalid program at 0 (OpPush): constant 1 is out of 1 constants",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpTrue, vm.OpJumpIfTrue, 9, 0}},
+			"invalid program at 1 (OpJumpIfTrue): jump target 13 is out of bytecode",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpTrue, vm.OpJump, 1, 0, vm.OpPush, 0, 0}, Constants: []interface{}{1}},
+			"invalid program at 1 (OpJump): jump into the middle of instruction at 5",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpTrue, vm.OpAdd}},
+			"invalid program at 1 (OpAdd): stack underflow",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpTrue, vm.OpTrue}},
+			"invalid program: stack is not balanced at exit",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpBegin, vm.OpTrue}},
+			"invalid program: 1 scopes are not closed at exit",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpTrue, vm.OpEnd}},
+			"invalid program at 1 (OpEnd): no scope to end",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpTrue, vm.OpJumpIfTrue, 1, 0, vm.OpBegin}},
+			"invalid program at 4 (OpBegin): scopes depth 1 does not match 0 at 5",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpTrue, vm.OpCall, 0, 0}, Constants: []interface{}{call}},
+			"invalid program at 1 (OpCall): stack underflow",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpCall, 0, 0}, Constants: []interface{}{"f"}},
+			"invalid program at 0 (OpCall): unexpected constant string",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpTrue, vm.OpMatchesConst, 0, 0}, Constants: []interface{}{"^a"}},
+			"invalid program at 1 (OpMatchesConst): unexpected constant string",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpTrue, vm.OpLoad, 0, 0}, Constants: []interface{}{"i"}},
+			"invalid program at 1 (OpLoad): no scope",
+		},
+		{
+			vm.Program{Bytecode: []byte{vm.OpTrue, vm.OpFetch, 0, 0, vm.OpArray}, Constants: []interface{}{"n"}},
+			"invalid program at 4 (OpArray): size of collection is unknown",
+		},
+	}
+
+	for _, test := range tests {
+		require.EqualError(t, vm.Verify(&test.program), test.err)
+	}
+
+	ok := vm.Program{
+		Bytecode:  []byte{vm.OpTrue, vm.OpMatchesConst, 0, 0},
+		Constants: []interface{}{regexp.MustCompile("^a")},
+	}
+	require.NoError(t, vm.Verify(&ok))
+}
@@ -2,9 +2,11 @@ package vm
 
 import (
 	"fmt"
+	"math/rand"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/byte-power/jsexpr/builtin"
 	"github.com/byte-power/jsexpr/file"
@@ -29,6 +31,7 @@ type VM struct {
 	stack     []interface{}
 	constants []interface{}
 	bytecode  []byte
+	wide      bool
 	ip        int
 	pp        int
 	scopes    []Scope
@@ -37,13 +40,23 @@ type VM struct {
 	curr      chan int
 	memory    int
 	limit     int
+	tracer    Tracer
 
 	builtinObjs  map[string]interface{}
 	builtinFuncs map[string]builtin.JSFunc
+	objsProgram  *Program // program builtinObjs overridden by clock or source are built for
 
-	structCallIndex int
-	structCallCache []string
-	envStructMap    map[string]fieldReflection
+	resolver Resolver
+	resolved map[string]resolved
+
+	clock  builtin.Clock
+	source rand.Source
+
+	callStack    bool
+	callArgLimit int
+
+	kleene  bool
+	pending []pending
 }
 
 func Debug() *VM {
@@ -55,33 +68,24 @@ func Debug() *VM {
 	return vm
 }
 
-func (vm *VM) initEnv(env interface{}) {
-	if env == nil {
-		return
-	}
-
-	v := reflect.ValueOf(env)
-	kind := v.Kind()
-	if kind == reflect.Ptr && reflect.Indirect(v).Kind() == reflect.Struct {
-		v = reflect.Indirect(v)
-		kind = v.Kind()
-	}
-
-	if kind != reflect.Struct {
-		return
-	}
-
-	vm.structCallCache = make([]string, 1<<10)
-	vm.envStructMap = structReflection(v)
-}
-
 func (vm *VM) Init(program *Program, env interface{}) {
 	vm.reset(program)
 
 	vm.limit = MemoryBudget
 	vm.builtinFuncs = builtin.Funcs()
-	vm.builtinObjs = builtin.Objs()
-	vm.initEnv(env)
+}
+
+// SetClock makes Date.now read clock instead of clock of program, nil resets it.
+func (vm *VM) SetClock(clock builtin.Clock) {
+	vm.clock = clock
+	vm.objsProgram = nil
+}
+
+// SetRandSource makes Math.random draw from source instead of
+// source of program, nil resets it.
+func (vm *VM) SetRandSource(source rand.Source) {
+	vm.source = source
+	vm.objsProgram = nil
 }
 
 func (vm *VM) reset(program *Program) {
@@ -101,17 +105,30 @@ func (vm *VM) reset(program *Program) {
 
 	vm.bytecode = program.Bytecode
 	vm.constants = program.Constants
-	vm.structCallIndex = 0
-}
+	vm.wide = program.Wide
+	vm.resolved = nil
+	vm.pending = vm.pending[0:0]
+
+	vm.callStack = program.CallStack
+	vm.callArgLimit = program.CallArgLimit
+	if vm.callArgLimit == 0 {
+		vm.callArgLimit = DefaultCallArgLimit
+	}
 
-func (vm *VM) getCurrentStructMap() map[string]fieldReflection {
-	calls := vm.structCallCache[:vm.structCallIndex]
-	// first lookup from injected env using current cached calls
-	current := vm.envStructMap
-	for _, fieldName := range calls {
-		current = current[fieldName].nestedFieldReflections
+	if vm.clock == nil && vm.source == nil {
+		vm.builtinObjs = program.objects()
+		vm.objsProgram = nil
+	} else if vm.objsProgram != program {
+		clock, source := vm.clock, vm.source
+		if clock == nil {
+			clock = program.Clock
+		}
+		if source == nil {
+			source = program.Rand
+		}
+		vm.builtinObjs = builtin.ObjsWith(clock, source)
+		vm.objsProgram = program
 	}
-	return current
 }
 
 func (vm *VM) getFieldFromStruct(v reflect.Value, f string) (interface{}, bool) {
@@ -156,11 +173,10 @@ func (vm *VM) fetch(from interface{}, i interface{}) interface{} {
 				return provider.FetchProperty(reflect.ValueOf(i).String())
 			}
 
-			m := vm.getCurrentStructMap()
-			if v, ok := m[i.(string)]; ok {
-				vm.structCallCache[vm.structCallIndex] = i.(string)
-				vm.structCallIndex++
-				return v.value.Interface()
+			if index, ok := fieldsOf(v.Type())[i.(string)]; ok {
+				if field, ok := fieldByIndex(v, index); ok {
+					return field.Interface()
+				}
 			}
 
 			if value, ok := vm.getFieldFromStruct(v, i.(string)); ok {
@@ -175,9 +191,110 @@ func (vm *VM) fetch(from interface{}, i interface{}) interface{} {
 	}
 
 	// still not found
+	if vm.kleene {
+		return Unknown
+	}
 	panic(fmt.Sprintf("cannot fetch %v from %T", i, from))
 }
 
+// resolved is a memoized result of Resolve.
+type resolved struct {
+	value interface{}
+	ok    bool
+}
+
+// fetchRoot fetches variable from env, asking resolver first.
+func (vm *VM) fetchRoot(env interface{}, i interface{}) interface{} {
+	if vm.resolver != nil {
+		if value, ok := vm.resolveRoot(i.(string)); ok {
+			return value
+		}
+	}
+	return vm.fetch(env, i)
+}
+
+// fetchMap fetches variable from map env, asking resolver first.
+func (vm *VM) fetchMap(env interface{}, name string) interface{} {
+	if vm.resolver != nil {
+		if value, ok := vm.resolveRoot(name); ok {
+			return value
+		}
+	}
+	m, ok := env.(map[string]interface{})
+	if !ok {
+		// Env of other type than the program was compiled for.
+		return vm.fetch(env, name)
+	}
+	value, ok := m[name]
+	if !ok && vm.kleene {
+		return Unknown
+	}
+	return value
+}
+
+// resolveRoot asks resolver for variable. Both resolved and unresolved
+// names are memoized, so Resolve is called once per name in a run.
+func (vm *VM) resolveRoot(name string) (interface{}, bool) {
+	if r, ok := vm.resolved[name]; ok {
+		return r.value, r.ok
+	}
+	value, ok := vm.resolve(name)
+	if vm.resolved == nil {
+		vm.resolved = make(map[string]resolved)
+	}
+	vm.resolved[name] = resolved{value: value, ok: ok}
+	return value, ok
+}
+
+// fetchField fetches env field by index path resolved at compile time.
+// Envs of other types than the program was compiled for, resolvers and
+// tracers fetch fields by names one by one.
+func (vm *VM) fetchField(env interface{}, field Field) interface{} {
+	if field.Type != nil && vm.resolver == nil && vm.tracer == nil {
+		v := reflect.ValueOf(env)
+		if v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.IsValid() && v.Type() == field.Type {
+			if value, ok := fieldByIndex(v, field.Path); ok {
+				return value.Interface()
+			}
+		}
+	}
+
+	var value interface{}
+	for i, name := range field.Names {
+		switch {
+		case vm.tracer != nil && i == 0:
+			value = vm.traceFetch(env, name, true)
+		case vm.tracer != nil:
+			value = vm.traceFetch(value, name, false)
+		case i == 0:
+			value = vm.fetchRoot(env, name)
+		default:
+			value = vm.fetch(value, name)
+		}
+	}
+	return value
+}
+
+func (vm *VM) resolve(name string) (interface{}, bool) {
+	defer vm.guard("Resolve", true, []interface{}{name})
+	return vm.resolver.Resolve(name)
+}
+
+func (vm *VM) traceFetch(from interface{}, i interface{}, root bool) interface{} {
+	start := time.Now()
+	var value interface{}
+	if root {
+		value = vm.fetchRoot(from, i)
+	} else {
+		value = vm.fetch(from, i)
+	}
+	vm.tracer.Fetch(fmt.Sprintf("%v", i), root, time.Since(start))
+	return value
+}
+
 func (vm *VM) fetchFn(from interface{}, name string, envCall bool) reflect.Value {
 	if from != nil {
 		v := reflect.ValueOf(from)
@@ -237,7 +354,7 @@ func (vm *VM) getFuncParamsFromStack(call Call) []reflect.Value {
 	return in
 }
 
-func (vm *VM) callFunc(f reflect.Value, call Call, in []reflect.Value) []reflect.Value {
+func (vm *VM) callFunc(f reflect.Value, call Call, method bool, in []reflect.Value) []reflect.Value {
 	fType := f.Type()
 	numIn := fType.NumIn()
 	var hasVariadic bool
@@ -253,31 +370,87 @@ func (vm *VM) callFunc(f reflect.Value, call Call, in []reflect.Value) []reflect
 			return call.Size
 		}
 	}()
-	return vm.call(f, in[:validParams], hasVariadic)
+	return vm.call(f, call.Name, method, in[:validParams], hasVariadic)
 }
 
-func (vm *VM) call(fn reflect.Value, input []reflect.Value, callVariadic bool) []reflect.Value {
+func (vm *VM) call(fn reflect.Value, name string, method bool, input []reflect.Value, callVariadic bool) []reflect.Value {
 	fType := fn.Type()
 
+	var castedInput []reflect.Value
 	if !callVariadic {
-		castedInput := make([]reflect.Value, len(input))
-		for i := 0; i < len(input); i++ {
+		castedInput = make([]reflect.Value, len(input))
+		for i := 0; i < len(input) && i < fType.NumIn(); i++ {
 			castedInput[i] = utility.ReflectCast(fType.In(i).Kind(), input[i])
 		}
-		return fn.Call(castedInput)
 	} else {
-		castedInput := make([]reflect.Value, fType.NumIn())
+		castedInput = make([]reflect.Value, fType.NumIn())
 		for i := 0; i < fType.NumIn(); i++ {
 			castedInput[i] = utility.ReflectCast(fType.In(i).Kind(), input[i])
 		}
+	}
+	// Panics of reflect are errors of vm, only ones of fn are guarded.
+	checkArgs(fType, name, castedInput, callVariadic)
+
+	defer vm.guard(name, method, castedInput)
+	if vm.tracer != nil {
+		start := time.Now()
+		defer func() { vm.tracer.Call(name, method, time.Since(start)) }()
+	}
+	if callVariadic {
 		return fn.CallSlice(castedInput)
 	}
+	return fn.Call(castedInput)
+}
+
+// checkArgs panics if function of type t can't be called with in,
+// the same way reflect would. Slice means variadic arguments are
+// passed as a slice.
+func checkArgs(t reflect.Type, name string, in []reflect.Value, slice bool) {
+	numIn := t.NumIn()
+	variadic := t.IsVariadic() && !slice
+	if variadic && len(in) < numIn-1 {
+		panic(fmt.Sprintf("wrong number of arguments to call %v: want at least %v, got %v", name, numIn-1, len(in)))
+	}
+	if !variadic && len(in) != numIn {
+		panic(fmt.Sprintf("wrong number of arguments to call %v: want %v, got %v", name, numIn, len(in)))
+	}
+	for i, arg := range in {
+		var want reflect.Type
+		if variadic && i >= numIn-1 {
+			want = t.In(numIn - 1).Elem()
+		} else {
+			want = t.In(i)
+		}
+		if !arg.IsValid() {
+			panic(fmt.Sprintf("cannot use nil as argument %v of %v (type %v)", i+1, name, want))
+		}
+		if !arg.Type().AssignableTo(want) {
+			panic(fmt.Sprintf("cannot use %v as argument %v of %v (type %v)", arg.Type(), i+1, name, want))
+		}
+	}
+}
 
+func (vm *VM) callFast(fn func(...interface{}) interface{}, name string, in []interface{}) interface{} {
+	defer vm.guard(name, false, in)
+	if vm.tracer != nil {
+		start := time.Now()
+		defer func() { vm.tracer.Call(name, false, time.Since(start)) }()
+	}
+	return fn(in...)
 }
 
 func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error) {
+	if vm.tracer != nil {
+		vm.tracer.RunStart(program)
+		defer func() { vm.tracer.RunEnd(program, out, err) }()
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
+			if callErr, ok := r.(*CallError); ok {
+				err = callErr.bind(program.Locations[vm.pp], program.Source)
+				return
+			}
 			f := &file.Error{
 				Location: program.Locations[vm.pp],
 				Message:  fmt.Sprintf("%v", r),
@@ -287,6 +460,7 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 	}()
 
 	vm.reset(program)
+	vm.resolver, _ = env.(Resolver)
 
 	for vm.ip < len(vm.bytecode) {
 
@@ -298,6 +472,18 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 		vm.ip++
 		op := vm.bytecode[vm.pp]
 
+		if vm.kleene {
+			vm.settle(vm.pp)
+		}
+
+		if vm.tracer != nil {
+			vm.tracer.Opcode(vm.pp, op)
+		}
+
+		if vm.kleene && vm.unknownOp(program, op) {
+			continue
+		}
+
 		switch op {
 
 		case OpPush:
@@ -313,11 +499,24 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 			vm.push(a)
 
 		case OpFetch:
-			vm.structCallIndex = 0
-			vm.push(vm.fetch(env, vm.constant()))
+			if vm.tracer != nil {
+				vm.push(vm.traceFetch(env, vm.constant(), true))
+				break
+			}
+			vm.push(vm.fetchRoot(env, vm.constant()))
+
+		case OpFetchField:
+			vm.push(vm.fetchField(env, vm.getField()))
 
 		case OpFetchMap:
-			vm.push(env.(map[string]interface{})[vm.constant().(string)])
+			if vm.tracer != nil {
+				start := time.Now()
+				name := vm.constant().(string)
+				vm.push(vm.fetchMap(env, name))
+				vm.tracer.Fetch(name, true, time.Since(start))
+				break
+			}
+			vm.push(vm.fetchMap(env, vm.constant().(string)))
 
 		case OpTrue:
 			vm.push(true)
@@ -351,25 +550,30 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 			a := vm.popThroughValueFetcher()
 			vm.push(a.(string) == b.(string))
 
+		case OpEqualFloat:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(float64) == b.(float64))
+
 		case OpJump:
 			offset := vm.arg()
-			vm.ip += int(offset)
+			vm.ip += offset
 
 		case OpJumpIfTrue:
 			offset := vm.arg()
 			if vm.current().(bool) {
-				vm.ip += int(offset)
+				vm.ip += offset
 			}
 
 		case OpJumpIfFalse:
 			offset := vm.arg()
 			if !vm.current().(bool) {
-				vm.ip += int(offset)
+				vm.ip += offset
 			}
 
 		case OpJumpBackward:
 			offset := vm.arg()
-			vm.ip -= int(offset)
+			vm.ip -= offset
 
 		case OpIn:
 			b := vm.popThroughValueFetcher()
@@ -421,6 +625,116 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 			a := vm.popThroughValueFetcher()
 			vm.push(modulo(a, b))
 
+		case OpAddInt:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(int) + b.(int))
+
+		case OpAddFloat:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(float64) + b.(float64))
+
+		case OpConcatString:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(string) + b.(string))
+
+		case OpSubtractInt:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(int) - b.(int))
+
+		case OpSubtractFloat:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(float64) - b.(float64))
+
+		case OpMultiplyInt:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(int) * b.(int))
+
+		case OpMultiplyFloat:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(float64) * b.(float64))
+
+		case OpDivideInt:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(int) / b.(int))
+
+		case OpDivideFloat:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(float64) / b.(float64))
+
+		case OpModuloInt:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(int) % b.(int))
+
+		case OpLessInt:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(int) < b.(int))
+
+		case OpLessFloat:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(float64) < b.(float64))
+
+		case OpLessString:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(string) < b.(string))
+
+		case OpMoreInt:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(int) > b.(int))
+
+		case OpMoreFloat:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(float64) > b.(float64))
+
+		case OpMoreString:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(string) > b.(string))
+
+		case OpLessOrEqualInt:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(int) <= b.(int))
+
+		case OpLessOrEqualFloat:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(float64) <= b.(float64))
+
+		case OpLessOrEqualString:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(string) <= b.(string))
+
+		case OpMoreOrEqualInt:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(int) >= b.(int))
+
+		case OpMoreOrEqualFloat:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(float64) >= b.(float64))
+
+		case OpMoreOrEqualString:
+			b := vm.popThroughValueFetcher()
+			a := vm.popThroughValueFetcher()
+			vm.push(a.(string) >= b.(string))
+
 		case OpExponent:
 			b := vm.popThroughValueFetcher()
 			a := vm.popThroughValueFetcher()
@@ -482,13 +796,17 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 		case OpProperty:
 			a := vm.pop()
 			b := vm.constant()
+			if vm.tracer != nil {
+				vm.push(vm.traceFetch(a, b, false))
+				break
+			}
 			vm.push(vm.fetch(a, b))
 
 		case OpCall:
 			call := vm.getCall()
 			in := vm.getFuncParamsFromStack(call)
 			f := vm.fetchFn(env, call.Name, true)
-			out := vm.callFunc(f, call, in)
+			out := vm.callFunc(f, call, false, in)
 			vm.push(out[0].Interface())
 
 		case OpCallFast:
@@ -498,13 +816,13 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 				in[i] = vm.popThroughValueFetcher()
 			}
 			fn := vm.fetchFn(env, call.Name, true).Interface()
-			vm.push(fn.(func(...interface{}) interface{})(in...))
+			vm.push(vm.callFast(fn.(func(...interface{}) interface{}), call.Name, in))
 
 		case OpMethod:
 			call := vm.getCall()
 			in := vm.getFuncParamsFromStack(call)
 			f := vm.fetchFn(vm.pop(), call.Name, false)
-			out := vm.callFunc(f, call, in)
+			out := vm.callFunc(f, call, true, in)
 			vm.push(out[0].Interface())
 
 		case OpArray:
@@ -584,6 +902,10 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 		close(vm.step)
 	}
 
+	if vm.kleene {
+		vm.settle(len(vm.bytecode))
+	}
+
 	if len(vm.stack) > 0 {
 		return vm.pop(), nil
 	}
@@ -613,10 +935,15 @@ func (vm *VM) popThroughValueFetcher() interface{} {
 	return v
 }
 
-func (vm *VM) arg() uint16 {
+func (vm *VM) arg() int {
+	if vm.wide {
+		b0, b1, b2, b3 := vm.bytecode[vm.ip], vm.bytecode[vm.ip+1], vm.bytecode[vm.ip+2], vm.bytecode[vm.ip+3]
+		vm.ip += 4
+		return int(uint32(b0) | uint32(b1)<<8 | uint32(b2)<<16 | uint32(b3)<<24)
+	}
 	b0, b1 := vm.bytecode[vm.ip], vm.bytecode[vm.ip+1]
 	vm.ip += 2
-	return uint16(b0) | uint16(b1)<<8
+	return int(uint16(b0) | uint16(b1)<<8)
 }
 
 func (vm *VM) constant() interface{} {
@@ -659,6 +986,45 @@ func (vm *VM) getCall() Call {
 	}
 }
 
+func (vm *VM) getField() Field {
+	field, ok := fieldOf(vm.constants[vm.arg()])
+	if !ok {
+		panic(fmt.Sprintf("no field"))
+	}
+	return field
+}
+
+// fieldOf returns Field of constant, which is a map if program is
+// decoded with msgpack. Decoded field has no Type, so it is fetched
+// by names.
+func fieldOf(c interface{}) (Field, bool) {
+	switch field := c.(type) {
+	case Field:
+		return field, true
+	case map[string]interface{}:
+		var f Field
+		switch names := field["names"].(type) {
+		case []string:
+			f.Names = names
+		case []interface{}:
+			for _, name := range names {
+				s, ok := name.(string)
+				if !ok {
+					return Field{}, false
+				}
+				f.Names = append(f.Names, s)
+			}
+		}
+		if path, ok := field["path"].([]interface{}); ok {
+			for _, i := range path {
+				f.Path = append(f.Path, AnyToInt(i))
+			}
+		}
+		return f, len(f.Names) > 0
+	}
+	return Field{}, false
+}
+
 func AnyToInt(value interface{}) int {
 	if value == nil {
 		return 0
@@ -2,8 +2,11 @@ package vm_test
 
 import (
 	"fmt"
+	"math/rand"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/byte-power/jsexpr/checker"
 	"github.com/byte-power/jsexpr/compiler"
@@ -107,3 +110,229 @@ func TestRun_memory_budget(t *testing.T) {
 	_, err = vm.Run(program, nil)
 	require.Error(t, err)
 }
+
+type panicEnv struct{}
+
+func (panicEnv) Explode(s string, i int) int {
+	panic("boom")
+}
+
+func (panicEnv) Join(items []string) string {
+	panic("boom")
+}
+
+func TestRun_call_panic(t *testing.T) {
+	input := `1 + explode("abc", 2)`
+
+	tree, err := parser.Parse(input)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+
+	_, err = vm.Run(program, panicEnv{})
+	require.Error(t, err)
+
+	callErr, ok := err.(*vm.CallError)
+	require.True(t, ok, "expected *vm.CallError, got %T", err)
+	require.Equal(t, "explode", callErr.Name)
+	require.Equal(t, []string{`string("abc")`, "int(2)"}, callErr.Args)
+	require.Equal(t, "boom", callErr.Value)
+	require.Empty(t, callErr.Stack)
+	require.Equal(t, "func explode(string(\"abc\"), int(2)) panicked: boom (1:5)\n | 1 + explode(\"abc\", 2)\n | ....^", err.Error())
+}
+
+func TestRun_call_panic_stack(t *testing.T) {
+	tree, err := parser.Parse(`explode("abc", 2)`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+	program.CallStack = true
+
+	_, err = vm.Run(program, panicEnv{})
+	require.Error(t, err)
+	require.Contains(t, string(err.(*vm.CallError).Stack), "Explode")
+}
+
+func TestRun_call_panic_arg_limit(t *testing.T) {
+	tree, err := parser.Parse(`explode("abcdefgh", 2)`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+	program.CallArgLimit = 4
+
+	_, err = vm.Run(program, panicEnv{})
+	require.Error(t, err)
+	require.Equal(t, []string{`string("abcd"...)`, "int(2)"}, err.(*vm.CallError).Args)
+}
+
+func TestRun_call_wrong_args_is_not_call_error(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`explode("abc")`, "wrong number of arguments to call explode: want 2, got 1"},
+		{`join(1)`, "cannot use int as argument 1 of join (type []string)"},
+	}
+
+	for _, test := range tests {
+		tree, err := parser.Parse(test.input)
+		require.NoError(t, err, test.input)
+
+		program, err := compiler.Compile(tree, nil)
+		require.NoError(t, err, test.input)
+
+		_, err = vm.Run(program, panicEnv{})
+		require.Error(t, err, test.input)
+		_, ok := err.(*vm.CallError)
+		require.False(t, ok, test.input)
+		require.Contains(t, err.Error(), test.err, test.input)
+	}
+}
+
+func TestRun_vm_error_is_not_call_error(t *testing.T) {
+	tree, err := parser.Parse(`1 / (1 - 1)`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+
+	_, err = vm.Run(program, nil)
+	require.Error(t, err)
+
+	_, ok := err.(*vm.CallError)
+	require.False(t, ok)
+}
+
+func TestRun_fetch_field(t *testing.T) {
+	type Address struct {
+		City string `jsexpr:"city"`
+	}
+	type Base struct {
+		ID int `jsexpr:"id"`
+	}
+	type User struct {
+		Base
+		Name    string   `jsexpr:"name"`
+		Address *Address `jsexpr:"address"`
+	}
+	type Env struct {
+		User User `jsexpr:"user"`
+	}
+
+	tests := []struct {
+		input  string
+		output interface{}
+	}{
+		{`user.name`, "Ann"},
+		{`user.id`, 7},
+		{`user.address.city + "!"`, "Oslo!"},
+	}
+
+	env := &Env{User: User{Base: Base{ID: 7}, Name: "Ann", Address: &Address{City: "Oslo"}}}
+	for _, test := range tests {
+		tree, err := parser.Parse(test.input)
+		require.NoError(t, err, test.input)
+
+		config := conf.New(Env{})
+		_, err = checker.Check(tree, config)
+		require.NoError(t, err, test.input)
+
+		program, err := compiler.Compile(tree, config)
+		require.NoError(t, err, test.input)
+		require.Equal(t, 1, strings.Count(program.Disassemble(), "OpFetchField"), test.input)
+
+		out, err := vm.Run(program, env)
+		require.NoError(t, err, test.input)
+		require.Equal(t, test.output, out, test.input)
+
+		// Envs of other types are fetched by names.
+		out, err = vm.Run(program, map[string]interface{}{"user": env.User})
+		require.NoError(t, err, test.input)
+		require.Equal(t, test.output, out, test.input)
+
+		// Fields decoded with msgpack are maps without type.
+		decoded := *program
+		decoded.Constants = make([]interface{}, len(program.Constants))
+		for i, c := range program.Constants {
+			decoded.Constants[i] = msgpackDecoded(c)
+		}
+		require.NoError(t, vm.Verify(&decoded), test.input)
+		out, err = vm.Run(&decoded, env)
+		require.NoError(t, err, test.input)
+		require.Equal(t, test.output, out, test.input)
+	}
+
+	tree, err := parser.Parse(`user.address.city`)
+	require.NoError(t, err)
+	config := conf.New(Env{})
+	_, err = checker.Check(tree, config)
+	require.NoError(t, err)
+	program, err := compiler.Compile(tree, config)
+	require.NoError(t, err)
+
+	_, err = vm.Run(program, Env{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot fetch city from *vm_test.Address")
+}
+
+// msgpackDecoded returns constant the way msgpack decodes it into
+// interface{}: structs become maps keyed by tags, slices []interface{}
+// and small integers int8.
+func msgpackDecoded(c interface{}) interface{} {
+	field, ok := c.(vm.Field)
+	if !ok {
+		return c
+	}
+	names := make([]interface{}, len(field.Names))
+	for i, name := range field.Names {
+		names[i] = name
+	}
+	path := make([]interface{}, len(field.Path))
+	for i, index := range field.Path {
+		path[i] = int8(index)
+	}
+	return map[string]interface{}{"names": names, "path": path}
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestRun_clock_and_rand(t *testing.T) {
+	tree, err := parser.Parse(`[Date.now(), Math.random()]`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, &conf.Config{
+		Clock: fixedClock(time.Unix(10, 0)),
+		Rand:  rand.NewSource(1),
+	})
+	require.NoError(t, err)
+
+	expected := rand.New(rand.NewSource(1))
+	for i := 0; i < 2; i++ {
+		// Runs share objects of program, so they continue the sequence of source.
+		out, err := vm.Run(program, nil)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{int64(10000), expected.Float64()}, out)
+	}
+
+	// Clock and source of VM take precedence over ones of program.
+	machine := vm.VM{}
+	machine.Init(program, nil)
+	machine.SetClock(fixedClock(time.Unix(20, 0)))
+	machine.SetRandSource(rand.NewSource(2))
+	out, err := machine.Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{int64(20000), rand.New(rand.NewSource(2)).Float64()}, out)
+
+	machine.SetClock(nil)
+	machine.SetRandSource(nil)
+	out, err = machine.Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{int64(10000), expected.Float64()}, out)
+}